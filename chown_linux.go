@@ -23,3 +23,8 @@ var chown = func(name string, info os.FileInfo) error {
 	}
 	return osChown(name, int(stat.Uid), int(stat.Gid))
 }
+
+// chownIDs sets the owner and group of name; -1 leaves either unchanged.
+var chownIDs = func(name string, uid, gid int) error {
+	return osChown(name, uid, gid)
+}
@@ -0,0 +1,284 @@
+package timberjack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Encrypted backups use a chunked AES-256-GCM format (the STREAM construction),
+// so they can be written and read without holding them in memory:
+//
+//	header: magic "TJENC\x01" | key ID length (1 byte) | key ID | nonce prefix (7 bytes)
+//	chunks: AES-256-GCM sealed chunks of encChunkSize bytes of plaintext; the last may be shorter or empty
+//
+// The nonce of chunk i is the nonce prefix, i as a 4-byte big-endian counter,
+// and a byte that is 1 for the last chunk and 0 otherwise. The header is the
+// additional data of every chunk. Reordering, modifying, or truncating chunks
+// therefore makes decryption fail.
+const (
+	encMagic           = "TJENC\x01"
+	encChunkSize       = 64 * 1024
+	encNoncePrefixSize = 7
+)
+
+// ErrDecrypt is returned when reading an encrypted backup that was modified,
+// truncated, or encrypted with a different key.
+var ErrDecrypt = errors.New("timberjack: decryption failed")
+
+// KeyProvider supplies the AES-256 keys used to encrypt backups. Keys are
+// identified by an ID that is stored in every encrypted backup, so keys can be
+// rotated while older backups stay readable.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the 32-byte key to encrypt new backups with.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given ID, to decrypt a backup.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider backed by a fixed set of keys.
+type StaticKeys struct {
+	Current string            // ID of the key new backups are encrypted with
+	Keys    map[string][]byte // 32-byte keys by ID
+}
+
+// CurrentKey implements KeyProvider.
+func (s StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.Current)
+	return s.Current, key, err
+}
+
+// Key implements KeyProvider.
+func (s StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("timberjack: unknown key %q", id)
+	}
+	return key, nil
+}
+
+// newAEAD returns AES-256-GCM for key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("timberjack: encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of chunk seq.
+func chunkNonce(prefix []byte, seq uint32, last bool) []byte {
+	nonce := make([]byte, 0, encNoncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, seq)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// encryptWriter encrypts everything written to it into w. Close must be
+// called to write the last chunk; it doesn't close w.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	buf    []byte // pending plaintext
+	out    []byte // sealed chunk
+	seq    uint32
+	closed bool
+	err    error
+}
+
+// newEncryptWriter writes the header of an encrypted stream to w, using the
+// current key of keys, and returns a writer for its plaintext.
+func newEncryptWriter(w io.Writer, keys KeyProvider) (*encryptWriter, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("can't get encryption key: %w", err)
+	}
+	if len(id) > math.MaxUint8 {
+		return nil, fmt.Errorf("timberjack: key ID %q is longer than 255 bytes", id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, encNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(encMagic)+1+len(id)+len(prefix))
+	header = append(header, encMagic...)
+	header = append(header, byte(len(id)))
+	header = append(header, id...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, 0, encChunkSize),
+	}, nil
+}
+
+// Write implements io.Writer.
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.closed {
+		return 0, errors.New("timberjack: write to closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(e.buf) == encChunkSize {
+			// More data follows, so the buffered chunk isn't the last one.
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		k := copy(e.buf[len(e.buf):encChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+// Close writes the last chunk.
+func (e *encryptWriter) Close() error {
+	if e.closed || e.err != nil {
+		return e.err
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+// flush seals and writes the buffered chunk.
+func (e *encryptWriter) flush(last bool) error {
+	if e.seq == math.MaxUint32 {
+		e.err = errors.New("timberjack: encrypted stream too long")
+		return e.err
+	}
+	e.out = e.aead.Seal(e.out[:0], chunkNonce(e.prefix, e.seq, last), e.buf, e.header)
+	e.seq++
+	e.buf = e.buf[:0]
+	if _, err := e.w.Write(e.out); err != nil {
+		e.err = err
+	}
+	return e.err
+}
+
+// decryptReader reads the plaintext of an encrypted stream.
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	buf    []byte // sealed chunk, opened in place
+	plain  []byte // unread plaintext of the current chunk
+	seq    uint32
+	done   bool // the last chunk was read
+	err    error
+}
+
+// NewDecryptReader returns a reader of the plaintext of an encrypted backup
+// (one with the ".enc" suffix) read from r, looking up its key in keys by the
+// ID stored in the backup. Reads fail with an error wrapping ErrDecrypt if the
+// backup was modified or truncated.
+//
+// Backups that were compressed before being encrypted (".gz.enc", ".zst.enc")
+// still need to be decompressed; OpenBackup does both.
+func NewDecryptReader(r io.Reader, keys KeyProvider) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, encChunkSize)
+	magic := make([]byte, len(encMagic)+1)
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic[:len(encMagic)], []byte(encMagic)) {
+		return nil, errors.New("timberjack: not an encrypted backup")
+	}
+	id := make([]byte, int(magic[len(encMagic)]))
+	prefix := make([]byte, encNoncePrefixSize)
+	if _, err := io.ReadFull(br, id); err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrDecrypt)
+	}
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrDecrypt)
+	}
+	key, err := keys.Key(string(id))
+	if err != nil {
+		return nil, fmt.Errorf("can't get decryption key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(magic)+len(id)+len(prefix))
+	header = append(header, magic...)
+	header = append(header, id...)
+	header = append(header, prefix...)
+	return &decryptReader{
+		r:      br,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, encChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Read implements io.Reader.
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk.
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.buf)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true // a short chunk is the last one
+	case err != nil:
+		return err
+	default:
+		if _, errPeek := d.r.Peek(1); errPeek == io.EOF {
+			last = true
+		} else if errPeek != nil {
+			return errPeek
+		}
+	}
+	plain, err := d.aead.Open(d.buf[:0], chunkNonce(d.prefix, d.seq, last), d.buf[:n], d.header)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d", ErrDecrypt, d.seq)
+	}
+	d.seq++
+	d.plain = plain
+	d.done = last
+	return nil
+}
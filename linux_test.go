@@ -4,8 +4,11 @@
 package timberjack
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -177,6 +180,150 @@ func TestCompressMaintainOwner(t *testing.T) {
 	equals(666, fakeFS.files[filename2+compressSuffix].gid, t)
 }
 
+func TestConfiguredPermissions(t *testing.T) {
+	fakeFS := newFakeFS()
+	osChown = fakeFS.Chown
+	defer func() { osChown = os.Chown }()
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestConfiguredPermissions", t)
+	defer os.RemoveAll(dir)
+
+	mode := func(name string) os.FileMode {
+		info, err := os.Stat(name)
+		isNil(err, t)
+		return info.Mode().Perm()
+	}
+
+	l := &Logger{
+		Filename:  filepath.Join(dir, "logs", "foobar.log"),
+		BackupDir: "archive",
+		FileMode:  0600,
+		DirMode:   0700,
+		Owner:     "555",
+		Group:     "666",
+		Manifest:  true,
+	}
+	defer l.Close()
+	writeOnce(t, l, "boo!")
+	newFakeTime()
+	isNil(l.Rotate(), t)
+
+	equals(os.FileMode(0600), mode(l.Filename), t)
+	equals(os.FileMode(0600), mode(l.manifestPath()), t)
+	equals(os.FileMode(0700), mode(filepath.Join(dir, "logs"))&0700, t)
+	equals(os.FileMode(0700), mode(filepath.Join(dir, "logs", "archive"))&0700, t)
+	for _, name := range []string{l.Filename, l.manifestPath()} {
+		equals(fakeFile{uid: 555, gid: 666}, fakeFS.files[name], t)
+	}
+
+	// Archives, made by a Logger whose mill runs on this goroutine.
+	dir2 := filepath.Join(dir, "other")
+	isNil(os.MkdirAll(dir2, 0755), t)
+	backup := filepath.Join(dir2, "foobar-2025-05-01T10-00-00.000-size.log")
+	isNil(os.WriteFile(backup, []byte("boo!"), 0644), t)
+	m := &Logger{Filename: filepath.Join(dir2, "foobar.log"), Compression: "gzip", ArchiveMode: 0440, Owner: "555", Group: "666"}
+	defer m.Close()
+	isNil(m.millRunOnce(), t)
+
+	equals(os.FileMode(0440), mode(backup+compressSuffix), t)
+	equals(fakeFile{uid: 555, gid: 666}, fakeFS.files[backup+compressSuffix], t)
+}
+
+func TestDefaultFileModes(t *testing.T) {
+	defer syscall.Umask(syscall.Umask(0022))
+
+	mode := func(name string) os.FileMode {
+		info, err := os.Stat(name)
+		isNil(err, t)
+		return info.Mode().Perm()
+	}
+
+	dir := t.TempDir()
+	l := &Logger{Filename: filepath.Join(dir, "foobar.log")}
+	writeOnce(t, l, "boo!")
+	equals(os.FileMode(0640), mode(l.Filename), t)
+	isNil(l.Close(), t)
+
+	// A write after Close creates the file with 0644, as it always has.
+	isNil(os.Remove(l.Filename), t)
+	writeOnce(t, l, "boo!")
+	equals(os.FileMode(0644), mode(l.Filename), t)
+}
+
+func TestOwnerAndGroupByName(t *testing.T) {
+	l := &Logger{Owner: "root", Group: "root"}
+	uid, gid := l.ownership()
+	equals(0, uid, t)
+	equals(0, gid, t)
+
+	l = &Logger{Owner: "no-such-user-timberjack"}
+	uid, gid = l.ownership()
+	equals(-1, uid, t)
+	equals(-1, gid, t)
+}
+
+func TestHandleSignals(t *testing.T) {
+	currentTime = fakeTime
+	dir := t.TempDir()
+	filename := logFile(dir)
+	l := &Logger{Filename: filename}
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type event struct {
+		sig    os.Signal
+		action SignalAction
+		err    error
+	}
+	events := make(chan event, 1)
+	err := l.HandleSignals(ctx, &SignalOptions{OnSignal: func(sig os.Signal, action SignalAction, err error) {
+		events <- event{sig, action, err}
+	}})
+	isNil(err, t)
+	send := func(sig syscall.Signal, action SignalAction) {
+		t.Helper()
+		isNil(syscall.Kill(os.Getpid(), sig), t)
+		select {
+		case e := <-events:
+			isNil(e.err, t)
+			equals(os.Signal(sig), e.sig, t)
+			equals(action, e.action, t)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("signal %v wasn't handled", sig)
+		}
+	}
+
+	// SIGHUP rotates.
+	_, err = l.Write([]byte("foo\n"))
+	isNil(err, t)
+	send(syscall.SIGHUP, SignalRotate)
+	existsWithContent(backupFileWithReason(dir, "sighup"), []byte("foo\n"), t)
+	existsWithContent(filename, []byte{}, t)
+
+	// SIGUSR1 reopens a file moved away by someone else, without a backup.
+	_, err = l.Write([]byte("bar\n"))
+	isNil(err, t)
+	moved := filepath.Join(dir, "moved.log")
+	isNil(os.Rename(filename, moved), t)
+	send(syscall.SIGUSR1, SignalReopen)
+	_, err = l.Write([]byte("baz\n"))
+	isNil(err, t)
+	existsWithContent(moved, []byte("bar\n"), t)
+	existsWithContent(filename, []byte("baz\n"), t)
+	fileCount(dir, 3, t)
+
+	// SIGTERM closes the Logger.
+	send(syscall.SIGTERM, SignalClose)
+	equals(uint32(1), atomic.LoadUint32(&l.isClosed), t)
+
+	err = l.HandleSignals(ctx, &SignalOptions{Actions: map[os.Signal]SignalAction{syscall.SIGHUP: "restart"}})
+	notNil(err, t)
+}
+
 type fakeFile struct {
 	uid int
 	gid int
@@ -0,0 +1,342 @@
+package timberjack
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Manager runs the background work of many Loggers with shared goroutines:
+// a single timer for the scheduled rotations (RotateAt, RotateAtMinutes),
+// idle checks (IdleTimeout) and interval syncs (SyncInterval) of all of them,
+// and a bounded pool of workers for compression and cleanup of backups.
+// Without a Manager, every Logger starts goroutines and timers of its own.
+//
+// A Manager is ready to use when created; Loggers sign up with Add. Close or
+// Shutdown the Manager to close all of its Loggers.
+type Manager struct {
+	// MillWorkers is the maximum number of Loggers whose backups are
+	// compressed and cleaned up at the same time. If zero,
+	// runtime.GOMAXPROCS(0) is used.
+	MillWorkers int
+
+	startOnce sync.Once
+	mu        sync.Mutex
+	loggers   []*Logger     // Loggers added and not closed yet
+	timers    rotationHeap  // next scheduled rotation and check of each Logger
+	closing   bool          // Close or Shutdown was called
+	wakeCh    chan struct{} // wakes the scheduler when timers changed
+	quitCh    chan struct{} // stops the scheduler
+	schedWg   sync.WaitGroup
+
+	millCond  *sync.Cond       // signals the mill workers (uses mu)
+	millQueue []*Logger        // Loggers waiting for a mill pass
+	queued    map[*Logger]bool // Loggers in millQueue
+	stopped   bool             // mill workers exit once millQueue is empty
+	workersWg sync.WaitGroup
+}
+
+// scheduledRotation is a pending scheduled rotation of a Logger, or another
+// timed check of it.
+type scheduledRotation struct {
+	at     time.Time
+	l      *Logger
+	kind   timerKind
+	recalc bool // no mark was found at the last attempt; only look for the next one
+}
+
+// timerKind is what a scheduledRotation does when it's due.
+type timerKind int
+
+const (
+	timerMark timerKind = iota // rotate at a RotateAt/RotateAtMinutes mark
+	timerIdle                  // rotate if idle (see Logger.rotateIfIdle)
+	timerSync                  // sync if due (see Logger.syncIfDue)
+)
+
+// rotationHeap orders scheduled rotations by time.
+type rotationHeap []scheduledRotation
+
+func (h rotationHeap) Len() int           { return len(h) }
+func (h rotationHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h rotationHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *rotationHeap) Push(x any)        { *h = append(*h, x.(scheduledRotation)) }
+func (h *rotationHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Add makes l run its scheduled rotations and its mill on the Manager
+// instead of on goroutines of its own. It must be called before l is first
+// used. Closing l removes it from the Manager.
+func (m *Manager) Add(l *Logger) error {
+	m.start()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.manager != nil || l.file != nil || l.millCh != nil || l.scheduledRotationQuitCh != nil ||
+		atomic.LoadUint32(&l.isClosed) == 1 {
+		return errors.New("timberjack: Logger is already in use")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		return errors.New("timberjack: Manager is closed")
+	}
+	l.manager = m
+	m.loggers = append(m.loggers, l)
+	return nil
+}
+
+// Close closes all Loggers of the Manager and stops its goroutines. Like
+// Logger.Close, it doesn't wait for compression or cleanup in progress.
+func (m *Manager) Close() error {
+	var errs []error
+	for _, l := range m.stopScheduler() {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.stopWorkers()
+	return errors.Join(errs...)
+}
+
+// Shutdown shuts down all Loggers of the Manager like Logger.Shutdown, and
+// waits for the mill workers to finish the remaining compression and cleanup
+// until ctx is done. If ctx expires first, it returns a *ShutdownError listing
+// the unarchived backups of all Loggers.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	loggers := m.stopScheduler()
+	var errs []error
+	for _, l := range loggers {
+		if err := l.beginShutdown(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.stopWorkers()
+
+	werr := waitContext(ctx, func() {
+		m.workersWg.Wait()
+		for _, l := range loggers {
+			l.millWg.Wait()
+		}
+	})
+	if werr != nil {
+		serr := &ShutdownError{Err: errors.Join(append([]error{werr}, errs...)...)}
+		for _, l := range loggers {
+			serr.Pending = append(serr.Pending, l.abandonMill()...)
+		}
+		return serr
+	}
+	return errors.Join(errs...)
+}
+
+// start starts the scheduler and the mill workers.
+func (m *Manager) start() {
+	m.startOnce.Do(func() {
+		m.millCond = sync.NewCond(&m.mu)
+		m.queued = make(map[*Logger]bool)
+		m.wakeCh = make(chan struct{}, 1)
+		m.quitCh = make(chan struct{})
+
+		workers := m.MillWorkers
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		m.workersWg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go m.millWorker()
+		}
+		m.schedWg.Add(1)
+		go m.runScheduler()
+	})
+}
+
+// stopScheduler stops accepting Loggers and scheduled rotations, waits for
+// the scheduler to exit, and returns the Loggers of the Manager.
+func (m *Manager) stopScheduler() []*Logger {
+	m.start()
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closing = true
+	m.timers = nil
+	loggers := append([]*Logger(nil), m.loggers...)
+	m.mu.Unlock()
+
+	close(m.quitCh)
+	m.schedWg.Wait()
+	return loggers
+}
+
+// stopWorkers lets the mill workers exit once the queued passes are done.
+func (m *Manager) stopWorkers() {
+	m.mu.Lock()
+	m.stopped = true
+	m.millCond.Broadcast()
+	m.mu.Unlock()
+}
+
+// remove removes a Logger that is being closed. It expects l.mu to be held.
+func (m *Manager) remove(l *Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, x := range m.loggers {
+		if x == l {
+			m.loggers = append(m.loggers[:i], m.loggers[i+1:]...)
+			break
+		}
+	}
+	for i := 0; i < len(m.timers); i++ {
+		if m.timers[i].l == l {
+			heap.Remove(&m.timers, i)
+			i--
+		}
+	}
+}
+
+// schedule queues the first scheduled rotation of l after from.
+func (m *Manager) schedule(l *Logger, from time.Time) {
+	next := scheduledRotation{l: l}
+	var found bool
+	next.at, found = nextScheduledRotation(from, l.processedRotateAt, l.location(), l.dstGapPolicy, l.dstOverlapPolicy)
+	if !found {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] Could not determine next scheduled rotation time for %v with marks %v. Retrying calculation in 1 minute.\n", l.Filename, from.In(l.location()), l.processedRotateAt)
+		next = scheduledRotation{at: from.Add(time.Minute), l: l, recalc: true}
+	}
+
+	m.push(next)
+}
+
+// scheduleCheck queues a check of l of the given kind at at.
+func (m *Manager) scheduleCheck(l *Logger, kind timerKind, at time.Time) {
+	m.push(scheduledRotation{at: at, l: l, kind: kind})
+}
+
+// push queues r and wakes up the scheduler.
+func (m *Manager) push(r scheduledRotation) {
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		return
+	}
+	heap.Push(&m.timers, r)
+	m.mu.Unlock()
+	select {
+	case m.wakeCh <- struct{}{}:
+	default: // the scheduler is already being woken up
+	}
+}
+
+// runScheduler sleeps until the earliest scheduled rotation of any Logger is
+// due and performs it.
+func (m *Manager) runScheduler() {
+	defer m.schedWg.Done()
+	for {
+		var timerC <-chan time.Time
+		var timer *time.Timer
+		m.mu.Lock()
+		if len(m.timers) > 0 {
+			timer = time.NewTimer(max(m.timers[0].at.Sub(currentTime()), 0))
+			timerC = timer.C
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-timerC:
+			m.rotateDue()
+		case <-m.wakeCh: // the earliest rotation may have changed
+		case <-m.quitCh:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-m.quitCh:
+			return
+		default:
+		}
+	}
+}
+
+// rotateDue performs the scheduled rotations and checks that are due and
+// schedules the next rotations; checks schedule themselves again if needed.
+func (m *Manager) rotateDue() {
+	now := currentTime()
+	var due []scheduledRotation
+	m.mu.Lock()
+	for len(m.timers) > 0 && !m.timers[0].at.After(now) {
+		due = append(due, heap.Pop(&m.timers).(scheduledRotation))
+	}
+	m.mu.Unlock()
+
+	for _, r := range due {
+		if r.kind != timerMark {
+			r.l.runCheck(r.kind)
+			continue
+		}
+		if !r.recalc {
+			r.l.rotateAtMark(r.at)
+		}
+		if atomic.LoadUint32(&r.l.isClosed) == 0 {
+			m.schedule(r.l, now)
+		}
+	}
+}
+
+// enqueueMill queues a mill pass of l for the workers, unless one is queued
+// already. Once the workers are stopped, the pass runs on its own goroutine.
+func (m *Manager) enqueueMill(l *Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queued[l] {
+		return
+	}
+	l.millWg.Add(1)
+	if m.stopped {
+		go func() {
+			defer l.millWg.Done()
+			_ = l.millRunOnce()
+		}()
+		return
+	}
+	m.queued[l] = true
+	m.millQueue = append(m.millQueue, l)
+	m.millCond.Signal()
+}
+
+// millWorker runs queued mill passes until the workers are stopped and the
+// queue is empty.
+func (m *Manager) millWorker() {
+	defer m.workersWg.Done()
+	for {
+		m.mu.Lock()
+		for len(m.millQueue) == 0 && !m.stopped {
+			m.millCond.Wait()
+		}
+		if len(m.millQueue) == 0 {
+			m.mu.Unlock()
+			return
+		}
+		l := m.millQueue[0]
+		m.millQueue = m.millQueue[1:]
+		delete(m.queued, l)
+		m.mu.Unlock()
+
+		if err := l.millRunOnce(); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to mill: %v\n", l.Filename, err)
+		}
+		l.millWg.Done()
+	}
+}
@@ -0,0 +1,269 @@
+package timberjack
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Router is an io.WriteCloser that writes every write to the Logger of a key
+// extracted from it, e.g. the lines of each tenant to a file of its own. The
+// Loggers are created on first use from a shared configuration, closed after
+// they have been idle for IdleTTL, and at most MaxOpen of them are kept open.
+//
+// A Logger closed by the Router is replaced by a new one on the next write for
+// its key, which appends to the same file once the old one is closed.
+type Router struct {
+	// Key returns the key of a write, e.g. the value of a "tenant=" field.
+	// It is required, except for writes through WriteKey.
+	Key func(p []byte) string
+
+	// Filename is the file of a key, in which "{key}" is replaced by the key,
+	// e.g. "logs/{key}.log". If empty, the key is appended to the name of
+	// Base.Filename: "logs/app.log" becomes "logs/app-<key>.log". Path
+	// separators in keys are replaced by "_", so every key stays in its
+	// directory.
+	Filename string
+
+	// Base is the configuration of the Loggers: each one is a copy of its
+	// exported fields, with Filename set from the key. If nil, the defaults
+	// of Logger are used.
+	Base *Logger
+
+	// IdleTTL is how long the Logger of a key may go without writes before it
+	// is closed. If zero, Loggers are only closed to respect MaxOpen.
+	IdleTTL time.Duration
+
+	// MaxOpen is the maximum number of Loggers kept open; the least recently
+	// used one is closed to make room for another. If zero, there is no limit.
+	MaxOpen int
+
+	// Manager, if set, runs the scheduled rotations and the mill of the
+	// Loggers (see Manager).
+	Manager *Manager
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *routeEntry, by key
+	lru     *list.List               // of *routeEntry, most recently used first
+	closing map[string]chan struct{} // keys whose evicted Logger is being closed
+	closed  bool
+
+	// For IdleTTL
+	startJanitorOnce sync.Once
+	janitorQuitCh    chan struct{}
+	janitorWg        sync.WaitGroup
+}
+
+// routeEntry is the Logger of a key.
+type routeEntry struct {
+	key      string
+	l        *Logger
+	lastUsed time.Time
+}
+
+// ensure we always implement io.WriteCloser
+var _ io.WriteCloser = (*Router)(nil)
+
+// Write implements io.Writer. It writes p to the Logger of Key(p).
+func (r *Router) Write(p []byte) (int, error) {
+	if r.Key == nil {
+		return 0, errors.New("timberjack: Router has no Key function")
+	}
+	return r.WriteKey(r.Key(p), p)
+}
+
+// WriteKey writes p to the Logger of key.
+func (r *Router) WriteKey(key string, p []byte) (int, error) {
+	for {
+		l, err := r.logger(key)
+		if err != nil {
+			return 0, err
+		}
+		if n, open, err := l.writeIfOpen(p); open {
+			return n, err
+		}
+		// The Logger was evicted meanwhile: write to its replacement.
+	}
+}
+
+// Close closes all Loggers of the Router. Writes after Close fail.
+func (r *Router) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	var loggers []*Logger
+	if r.lru != nil {
+		for e := r.lru.Front(); e != nil; e = e.Next() {
+			loggers = append(loggers, e.Value.(*routeEntry).l)
+		}
+	}
+	r.entries, r.lru = nil, nil
+	quitCh := r.janitorQuitCh
+	r.mu.Unlock()
+
+	if quitCh != nil {
+		close(quitCh)
+		r.janitorWg.Wait()
+	}
+	var errs []error
+	for _, l := range loggers {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logger returns the Logger of key, creating it if needed. If the previous
+// Logger of key is being closed, it waits for it first.
+func (r *Router) logger(key string) (*Logger, error) {
+	r.mu.Lock()
+	for {
+		if r.closed {
+			r.mu.Unlock()
+			return nil, errors.New("timberjack: write to closed Router")
+		}
+		done, ok := r.closing[key]
+		if !ok {
+			break
+		}
+		r.mu.Unlock()
+		<-done
+		r.mu.Lock()
+	}
+	now := currentTime()
+	if r.entries == nil {
+		r.entries = make(map[string]*list.Element)
+		r.lru = list.New()
+		r.closing = make(map[string]chan struct{})
+	}
+	if e, ok := r.entries[key]; ok {
+		r.lru.MoveToFront(e)
+		entry := e.Value.(*routeEntry)
+		entry.lastUsed = now
+		r.mu.Unlock()
+		return entry.l, nil
+	}
+
+	l := r.newLogger(key)
+	if r.Manager != nil {
+		if err := r.Manager.Add(l); err != nil {
+			r.mu.Unlock()
+			return nil, err
+		}
+	}
+	r.entries[key] = r.lru.PushFront(&routeEntry{key: key, l: l, lastUsed: now})
+	var evicted []*routeEntry
+	for r.MaxOpen > 0 && r.lru.Len() > r.MaxOpen {
+		evicted = append(evicted, r.remove(r.lru.Back()))
+	}
+	if r.IdleTTL > 0 {
+		r.startJanitorOnce.Do(func() {
+			r.janitorQuitCh = make(chan struct{})
+			r.janitorWg.Add(1)
+			go r.runJanitor(r.janitorQuitCh)
+		})
+	}
+	r.mu.Unlock()
+
+	r.closeEvicted(evicted)
+	return l, nil
+}
+
+// newLogger returns a Logger for key configured from Base.
+func (r *Router) newLogger(key string) *Logger {
+	l := &Logger{}
+	if r.Base != nil {
+		// Copy the configuration, not the state (which includes locks).
+		src := reflect.ValueOf(r.Base).Elem()
+		dst := reflect.ValueOf(l).Elem()
+		for i := 0; i < src.NumField(); i++ {
+			if src.Type().Field(i).IsExported() {
+				dst.Field(i).Set(src.Field(i))
+			}
+		}
+	}
+	l.Filename = r.filename(key)
+	return l
+}
+
+// filename returns the file of key.
+func (r *Router) filename(key string) string {
+	key = strings.NewReplacer("/", "_", `\`, "_", "\x00", "_").Replace(key)
+	if key == "" || key == "." || key == ".." {
+		key = strings.Repeat("_", max(len(key), 1))
+	}
+	if r.Filename != "" {
+		return strings.ReplaceAll(r.Filename, "{key}", key)
+	}
+	base := &Logger{}
+	if r.Base != nil {
+		base.Filename = r.Base.Filename
+	}
+	prefix, ext := base.prefixAndExt()
+	return filepath.Join(base.dir(), prefix+key+ext)
+}
+
+// remove removes the entry e, to be closed with closeEvicted, and returns it.
+// Until then, no new Logger is created for its key. It expects r.mu to be held.
+func (r *Router) remove(e *list.Element) *routeEntry {
+	entry := r.lru.Remove(e).(*routeEntry)
+	delete(r.entries, entry.key)
+	r.closing[entry.key] = make(chan struct{})
+	return entry
+}
+
+// evictIdle removes the Loggers that haven't been written to for IdleTTL and
+// closes them.
+func (r *Router) evictIdle() {
+	cutoff := currentTime().Add(-r.IdleTTL)
+	var evicted []*routeEntry
+	r.mu.Lock()
+	if r.lru != nil {
+		// Entries are ordered by use, so the idle ones are at the back.
+		for e := r.lru.Back(); e != nil && e.Value.(*routeEntry).lastUsed.Before(cutoff); e = r.lru.Back() {
+			evicted = append(evicted, r.remove(e))
+		}
+	}
+	r.mu.Unlock()
+	r.closeEvicted(evicted)
+}
+
+// runJanitor closes idle Loggers until quitCh is closed.
+func (r *Router) runJanitor(quitCh chan struct{}) {
+	defer r.janitorWg.Done()
+	ticker := time.NewTicker(max(r.IdleTTL/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.evictIdle()
+		case <-quitCh:
+			return
+		}
+	}
+}
+
+// closeEvicted closes the Loggers of entries removed from the Router, and lets
+// their keys get new ones.
+func (r *Router) closeEvicted(entries []*routeEntry) {
+	for _, entry := range entries {
+		if err := entry.l.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to close evicted logger: %v\n", entry.l.Filename, err)
+		}
+		r.mu.Lock()
+		close(r.closing[entry.key])
+		delete(r.closing, entry.key)
+		r.mu.Unlock()
+	}
+}
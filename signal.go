@@ -0,0 +1,116 @@
+package timberjack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// SignalAction is what HandleSignals does when a signal is received.
+type SignalAction string
+
+const (
+	// SignalRotate rotates the file, with the name of the signal as the
+	// reason, e.g. "sighup".
+	SignalRotate SignalAction = "rotate"
+	// SignalReopen reopens Filename (see Logger.Reopen).
+	SignalReopen SignalAction = "reopen"
+	// SignalClose closes the Logger and stops handling signals.
+	SignalClose SignalAction = "close"
+)
+
+// SignalOptions configures HandleSignals.
+type SignalOptions struct {
+	// Actions maps signals to what is done when they are received. If nil,
+	// DefaultSignalActions is used.
+	Actions map[os.Signal]SignalAction
+
+	// OnSignal, if set, is called after the action of a signal was done,
+	// with its error, e.g. to exit once the Logger was closed. If nil,
+	// errors are reported on stderr.
+	OnSignal func(sig os.Signal, action SignalAction, err error)
+}
+
+// DefaultSignalActions returns the actions used by HandleSignals when none
+// are configured: on Unix, SIGHUP rotates, SIGUSR1 reopens and SIGTERM
+// closes the Logger; elsewhere, os.Interrupt closes the Logger.
+func DefaultSignalActions() map[os.Signal]SignalAction {
+	return defaultSignalActions()
+}
+
+// HandleSignals handles signals sent to the process with the actions of
+// opts, until ctx is done or a signal closed the Logger. It returns once
+// the signals are being handled; opts may be nil.
+//
+// Signals handled here are no longer handled by the Go runtime: a SIGTERM
+// mapped to SignalClose doesn't terminate the program anymore, so use
+// OnSignal to exit.
+func (l *Logger) HandleSignals(ctx context.Context, opts *SignalOptions) error {
+	var actions map[os.Signal]SignalAction
+	var onSignal func(os.Signal, SignalAction, error)
+	if opts != nil {
+		actions, onSignal = opts.Actions, opts.OnSignal
+	}
+	if actions == nil {
+		actions = defaultSignalActions()
+	}
+	if len(actions) == 0 {
+		return errors.New("timberjack: no signals to handle")
+	}
+	sigs := make([]os.Signal, 0, len(actions))
+	for sig, action := range actions {
+		switch action {
+		case SignalRotate, SignalReopen, SignalClose:
+		default:
+			return fmt.Errorf("timberjack: unknown action %q for signal %v", action, sig)
+		}
+		sigs = append(sigs, sig)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sigs...)
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case sig := <-sigCh:
+				action := actions[sig]
+				err := l.signalAction(sig, action)
+				if onSignal != nil {
+					onSignal(sig, action, err)
+				} else if err != nil {
+					fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to %s on %v: %v\n", l.Filename, action, sig, err)
+				}
+				if action == SignalClose {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// signalAction does action for sig.
+func (l *Logger) signalAction(sig os.Signal, action SignalAction) error {
+	switch action {
+	case SignalRotate:
+		return l.RotateWithReason(signalName(sig))
+	case SignalReopen:
+		return l.Reopen()
+	default:
+		return l.Close()
+	}
+}
+
+// signalName returns the name of sig as a rotation reason, e.g. "sighup".
+func signalName(sig os.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return "signal-" + strings.ReplaceAll(sig.String(), " ", "-")
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package timberjack
+
+import (
+	"os"
+)
+
+var signalNames = map[os.Signal]string{
+	os.Interrupt: "sigint",
+}
+
+func defaultSignalActions() map[os.Signal]SignalAction {
+	return map[os.Signal]SignalAction{
+		os.Interrupt: SignalClose,
+	}
+}
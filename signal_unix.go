@@ -0,0 +1,24 @@
+//go:build unix
+
+package timberjack
+
+import (
+	"os"
+	"syscall"
+)
+
+var signalNames = map[os.Signal]string{
+	syscall.SIGHUP:  "sighup",
+	syscall.SIGINT:  "sigint",
+	syscall.SIGTERM: "sigterm",
+	syscall.SIGUSR1: "sigusr1",
+	syscall.SIGUSR2: "sigusr2",
+}
+
+func defaultSignalActions() map[os.Signal]SignalAction {
+	return map[os.Signal]SignalAction{
+		syscall.SIGHUP:  SignalRotate,
+		syscall.SIGUSR1: SignalReopen,
+		syscall.SIGTERM: SignalClose,
+	}
+}
@@ -0,0 +1,127 @@
+// Package slog provides a log/slog Handler that writes records to timberjack
+// Loggers, as JSON or text, optionally sending records of some levels to
+// separate files as well:
+//
+//	logger := &timberjack.Logger{Filename: "/var/log/myapp/app.log"}
+//	errLog := &timberjack.Logger{Filename: "/var/log/myapp/app.error.log"}
+//	h := tjslog.NewHandler(logger, &tjslog.Options{
+//		Routes: []tjslog.Route{{Level: slog.LevelError, Writer: errLog}},
+//	})
+//	slog.SetDefault(slog.New(h))
+//
+// Every record is written with a single call to Write, so a record is never
+// split across files by size rotation.
+package slog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Options configures a Handler.
+type Options struct {
+	// HandlerOptions are passed to the JSON or text handler that formats
+	// records. Its Level is the minimum level of the main Logger.
+	slog.HandlerOptions
+
+	// Text selects slog's text format instead of JSON.
+	Text bool
+
+	// Routes also write records of at least a level to other Loggers.
+	Routes []Route
+}
+
+// Route writes records of at least Level to Writer, in addition to the main
+// Logger.
+type Route struct {
+	// Level is the minimum level of the records to write. If nil, it is
+	// slog.LevelInfo.
+	Level slog.Leveler
+
+	// Writer is usually a *timberjack.Logger, or a *timberjack.Router. Routes
+	// with a nil Writer are skipped, with a warning on stderr.
+	Writer io.Writer
+}
+
+// Handler is a slog.Handler that writes records to timberjack Loggers.
+type Handler struct {
+	handlers []slog.Handler // the main Logger's, then one per Route
+}
+
+// NewHandler returns a Handler that writes records to w, usually a
+// *timberjack.Logger, and to the Writers of opts.Routes. If opts is nil, the
+// defaults are used.
+func NewHandler(w io.Writer, opts *Options) *Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+	h := &Handler{handlers: []slog.Handler{newFormatter(w, opts, opts.Level)}}
+	for i, r := range opts.Routes {
+		if r.Writer == nil {
+			fmt.Fprintf(os.Stderr, "timberjack: slog route %d has no Writer — skipping it\n", i)
+			continue
+		}
+		h.handlers = append(h.handlers, newFormatter(r.Writer, opts, r.Level))
+	}
+	return h
+}
+
+// newFormatter returns a JSON or text handler writing records of at least
+// level to w. These write every record with a single call to Write.
+func newFormatter(w io.Writer, opts *Options, level slog.Leveler) slog.Handler {
+	ho := opts.HandlerOptions
+	ho.Level = level
+	if opts.Text {
+		return slog.NewTextHandler(w, &ho)
+	}
+	return slog.NewJSONHandler(w, &ho)
+}
+
+// Enabled implements slog.Handler. It reports whether any of the Loggers
+// takes records of level.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, f := range h.handlers {
+		if f.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle implements slog.Handler. It writes r to every Logger that takes
+// records of its level.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, f := range h.handlers {
+		if !f.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := f.Handle(ctx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(f slog.Handler) slog.Handler { return f.WithAttrs(attrs) })
+}
+
+// WithGroup implements slog.Handler.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return h.with(func(f slog.Handler) slog.Handler { return f.WithGroup(name) })
+}
+
+// with returns a Handler with fn applied to the handler of every Logger.
+func (h *Handler) with(fn func(slog.Handler) slog.Handler) *Handler {
+	h2 := &Handler{handlers: make([]slog.Handler, len(h.handlers))}
+	for i, f := range h.handlers {
+		h2.handlers[i] = fn(f)
+	}
+	return h2
+}
@@ -0,0 +1,100 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/traceforce/timberjack"
+)
+
+func TestHandler_RoutesLevels(t *testing.T) {
+	dir := t.TempDir()
+	all := &timberjack.Logger{Filename: filepath.Join(dir, "app.log")}
+	defer all.Close()
+	errs := &timberjack.Logger{Filename: filepath.Join(dir, "app.error.log")}
+	defer errs.Close()
+
+	logger := slog.New(NewHandler(all, &Options{
+		HandlerOptions: slog.HandlerOptions{Level: slog.LevelDebug},
+		Routes:         []Route{{Level: slog.LevelError, Writer: errs}},
+	})).With("service", "api")
+	logger.Debug("starting")
+	logger.Info("ready", "port", 8080)
+	logger.Error("failed", "err", "boom")
+
+	lines := readLines(t, all.Filename)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records in app.log, got %d: %q", len(lines), lines)
+	}
+	errLines := readLines(t, errs.Filename)
+	if len(errLines) != 1 {
+		t.Fatalf("expected 1 record in app.error.log, got %d: %q", len(errLines), errLines)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(errLines[0]), &rec); err != nil {
+		t.Fatalf("invalid JSON record %q: %v", errLines[0], err)
+	}
+	if rec["msg"] != "failed" || rec["level"] != "ERROR" || rec["service"] != "api" {
+		t.Fatalf("unexpected record %v", rec)
+	}
+}
+
+func TestHandler_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &Options{Text: true})).WithGroup("req")
+	logger.Debug("hidden") // below the default level
+	logger.Info("done", "id", 7)
+
+	out := buf.String()
+	if strings.Count(out, "\n") != 1 || !strings.Contains(out, "msg=done req.id=7") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestHandler_RouteWithoutWriter(t *testing.T) {
+	var main, errs bytes.Buffer
+	logger := slog.New(NewHandler(&main, &Options{
+		Routes: []Route{{Level: slog.LevelError}, {Level: slog.LevelError, Writer: &errs}},
+	}))
+	logger.Error("failed")
+
+	if strings.Count(main.String(), "\n") != 1 || strings.Count(errs.String(), "\n") != 1 {
+		t.Fatalf("unexpected output %q and %q", main.String(), errs.String())
+	}
+}
+
+// countingWriter counts calls to Write.
+type countingWriter struct {
+	writes int
+	buf    bytes.Buffer
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func TestHandler_OneWritePerRecord(t *testing.T) {
+	w := &countingWriter{}
+	logger := slog.New(NewHandler(w, nil))
+	for i := 0; i < 10; i++ {
+		logger.Info("record", "i", i, "payload", strings.Repeat("x", 10000), slog.Group("g", "a", 1, "b", 2))
+	}
+	if w.writes != 10 {
+		t.Fatalf("expected 10 writes, got %d", w.writes)
+	}
+}
+
+func readLines(t *testing.T, name string) []string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
@@ -25,14 +25,26 @@
 package timberjack
 
 import (
+	"bufio"
+	"bytes"
 	"cmp"
 	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"math"
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
 	"slices"
 	"sort"
 	"strconv"
@@ -45,11 +57,48 @@ import (
 	"github.com/klauspost/compress/zstd"
 )
 
+const (
+	// DST policies for scheduled rotations (see DSTGapPolicy and DSTOverlapPolicy).
+	dstShift = "shift"
+	dstSkip  = "skip"
+	dstFirst = "first"
+	dstLast  = "last"
+	dstBoth  = "both"
+)
+
+const (
+	// Values of MinRotationPolicy.
+	rotationGrow  = "grow"
+	rotationBlock = "block"
+)
+
+const (
+	// Values of SyncPolicy.
+	syncNone     = "none"
+	syncWrite    = "write"
+	syncBytes    = "bytes"
+	syncInterval = "interval"
+	syncRotate   = "rotate"
+)
+
 const (
 	backupTimeFormat = "2006-01-02T15-04-05.000"
 	compressSuffix   = ".gz"
 	zstdSuffix       = ".zst"
-	defaultMaxSize   = 100
+	encSuffix        = ".enc"
+	// compressTempSuffix marks compressed files that are still being written.
+	compressTempSuffix = ".tmp"
+	// corruptSuffix marks incomplete archives that recovery moved aside.
+	corruptSuffix  = ".corrupt"
+	defaultMaxSize = 100
+
+	// Defaults of RetryBackoff and MaxRetryBackoff.
+	defaultRetryBackoff    = time.Second
+	defaultMaxRetryBackoff = time.Minute
+
+	// Defaults of SyncEveryBytes and SyncInterval.
+	defaultSyncEveryBytes = 1024 * 1024
+	defaultSyncInterval   = time.Second
 )
 
 // ensure we always implement io.WriteCloser
@@ -69,6 +118,16 @@ func safeClose[T any](ch chan T) {
 
 type rotateAt [2]int
 
+// SegmentInfo describes a log file, for the Header and Footer hooks.
+type SegmentInfo struct {
+	Filename string    // path of the file (Filename, or the time-stamped file with ActiveFileTimeFormat)
+	Start    time.Time // when the file was started, if known
+	End      time.Time // Footer only: time of the rotation
+	Size     int64     // Footer only: bytes in the file before the footer
+	Reason   string    // reason of the rotation that ends this file (Footer) or the previous one (Header)
+	Previous string    // Header only: path of the previous file's backup, if there was one
+}
+
 // Logger is an io.WriteCloser that writes to the specified filename.
 //
 // Logger opens or creates the logfile on the first Write.
@@ -81,7 +140,7 @@ type rotateAt [2]int
 // Backups use the log file name given to Logger, in the form:
 // `name-timestamp-<reason>.ext` where `name` is the filename without the extension,
 // `timestamp` is the time of rotation formatted as `2006-01-02T15-04-05.000`,
-// `reason` is "size" or "time" (Rotate/auto), or a custom tag (RotateWithReason), and `ext` is the original extension.
+// `reason` is "size", "lines" or "time" (Rotate/auto), or a custom tag (RotateWithReason), and `ext` is the original extension.
 // For example, if your Logger.Filename is `/var/log/foo/server.log`, a backup created at 6:30pm on Nov 11 2016
 // due to size would use the filename `/var/log/foo/server-2016-11-04T18-30-00.000-size.log`.
 //
@@ -97,7 +156,7 @@ type rotateAt [2]int
 // timberjack assumes only a single process is writing to the log files at a time.
 type Logger struct {
 	// Filename is the file to write logs to.  Backup log files will be retained
-	// in the same directory.  It uses <processname>-timberjack.log in
+	// in the same directory unless BackupDir is set.  It uses <processname>-timberjack.log in
 	// os.TempDir() if empty.
 	Filename string `json:"filename" yaml:"filename"`
 
@@ -117,11 +176,46 @@ type Logger struct {
 	// deleted.) MaxBackups counts distinct rotation events (timestamps).
 	MaxBackups int `json:"maxbackups" yaml:"maxbackups"`
 
+	// MaxLines is the maximum number of lines (newlines) in the log file before
+	// it gets rotated with reason "lines". A write that would take the file past
+	// MaxLines goes to a new file; a single write with more lines is not split.
+	// Lines written by Header and Footer don't count, except when an existing
+	// file is reopened (e.g. after a restart): all of its newlines are counted
+	// then, so it may rotate a few lines early. Zero disables it.
+	MaxLines int `json:"maxlines,omitempty" yaml:"maxlines,omitempty"`
+
+	// MinRotationInterval is the minimum age of a log file before it may be
+	// rotated because of MaxSize or MaxLines, to limit the rate of rotations
+	// under bursty traffic. What happens to writes meanwhile is decided by
+	// MinRotationPolicy. Time-based and manual rotations are not affected. A
+	// reopened file (e.g. after a restart) is taken to have started at the
+	// newest backup, or at its last modification if there is none.
+	MinRotationInterval time.Duration `json:"minrotationinterval,omitempty" yaml:"minrotationinterval,omitempty"`
+
+	// MinRotationPolicy decides what happens to a write that would rotate a
+	// file younger than MinRotationInterval:
+	//   "grow" (default): the write goes to the current file, past MaxSize or MaxLines
+	//   "block":          Write waits until the file is old enough, then rotates it;
+	//                     the Logger isn't locked meanwhile, and Close ends the wait
+	// Either way it is counted in SuppressedRotations.
+	// Unknown values => "grow" (with a warning).
+	MinRotationPolicy string `json:"minrotationpolicy,omitempty" yaml:"minrotationpolicy,omitempty"`
+
 	// LocalTime determines if the time used for formatting the timestamps in
 	// backup files is the computer's local time.  The default is to use UTC
-	// time.
+	// time. It is ignored if Location or TimeZone is set.
 	LocalTime bool `json:"localtime" yaml:"localtime"`
 
+	// Location is the time zone used for backup timestamps, time-stamped
+	// directory and file names, and scheduled rotations (RotateAt/RotateAtMinutes).
+	// It takes precedence over TimeZone and LocalTime.
+	Location *time.Location `json:"-" yaml:"-"`
+
+	// TimeZone is an IANA time zone name such as "Europe/Berlin", resolved with
+	// time.LoadLocation and used like Location. It takes precedence over
+	// LocalTime. An unknown name falls back to LocalTime with a warning.
+	TimeZone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+
 	// Deprecated: use Compression instead ("none" | "gzip" | "zstd").
 	Compress bool `json:"compress,omitempty" yaml:"compress,omitempty"`
 
@@ -129,6 +223,39 @@ type Logger struct {
 	// Allowed values: "none", "gzip", "zstd". Unknown => "none" (with a warning).
 	Compression string `json:"compression,omitempty" yaml:"compression,omitempty"`
 
+	// VerifyCompression makes the mill decompress every new archive and compare
+	// its SHA-256 checksum with the source before removing the source. On a
+	// mismatch the archive is discarded, the source kept, and a *VerifyError
+	// reported on stderr. It roughly doubles the CPU cost of compression.
+	VerifyCompression bool `json:"verifycompression,omitempty" yaml:"verifycompression,omitempty"`
+
+	// KeyProvider enables encryption at rest. The mill encrypts every backup
+	// with AES-256-GCM in a streaming format, after compressing it if
+	// compression is enabled, and adds the ".enc" suffix (e.g. "foo-...-size.log.gz.enc").
+	// Backups that were already compressed before KeyProvider was set are left
+	// as they are. Use OpenBackup or NewDecryptReader to read encrypted backups.
+	KeyProvider KeyProvider `json:"-" yaml:"-"`
+
+	// Manifest enables an audit manifest of backups: a JSON lines file named
+	// <Filename>.manifest.jsonl (e.g. app.log.manifest.jsonl) next to the log
+	// file. Every rotation appends a ManifestEntry with the backup's SHA-256, and
+	// the mill appends entries when it compresses or removes a backup. A file
+	// that was reopened is checksummed by the mill, after its rotation.
+	// VerifyManifest checks the backups on disk against it.
+	Manifest bool `json:"manifest,omitempty" yaml:"manifest,omitempty"`
+
+	// HashChain enables a tamper-evident chain of backups: a JSON lines file
+	// named <Filename>.chain.jsonl next to the log file. Every rotation appends
+	// a ChainLink committing to the SHA-256 of the rotated segment and to the
+	// previous link, and the mill appends a link for every backup it removes,
+	// so modifying or deleting any backup (other than by retention) breaks the
+	// chain. VerifyChain checks it. Appending to or truncating the end of the
+	// chain is only detectable if the latest digest is kept elsewhere.
+	HashChain bool `json:"hashchain,omitempty" yaml:"hashchain,omitempty"`
+
+	// ChainSigningKey, if set, signs every ChainLink digest with ed25519.
+	ChainSigningKey ed25519.PrivateKey `json:"-" yaml:"-"`
+
 	// RotationInterval is the maximum duration between log rotations.
 	// If the elapsed time since the last rotation exceeds this interval,
 	// the log file is rotated, even if the file size has not reached MaxSize.
@@ -167,24 +294,170 @@ type Logger struct {
 	// If multiple rotation conditions are met, the first one encountered typically triggers.
 	RotateAt []string `json:"rotateAt" yaml:"rotateAt"`
 
+	// DSTGapPolicy decides what happens to a RotateAt/RotateAtMinutes mark that does
+	// not exist on a given day because the clock springs forward (e.g. "02:30" when
+	// clocks jump from 02:00 to 03:00).
+	// "shift" (default) fires once at the first instant after the gap; "skip" drops
+	// the mark for that day.
+	DSTGapPolicy string `json:"dstGapPolicy,omitempty" yaml:"dstGapPolicy,omitempty"`
+
+	// DSTOverlapPolicy decides what happens to a RotateAt/RotateAtMinutes mark that
+	// occurs twice on a given day because the clock falls back (e.g. "02:30" when
+	// clocks go from 03:00 back to 02:00).
+	// "first" (default) fires once at the first occurrence, "last" fires once at the
+	// second occurrence and "both" fires at each of them.
+	DSTOverlapPolicy string `json:"dstOverlapPolicy,omitempty" yaml:"dstOverlapPolicy,omitempty"`
+
 	// AppendTimeAfterExt controls where the timestamp/reason go.
 	// false (default):  <name>-<timestamp>-<reason>.log
 	// true:             <name>.log-<timestamp>-<reason>
 	AppendTimeAfterExt bool `json:"appendTimeAfterExt" yaml:"appendTimeAfterExt"`
 
+	// BackupDir is the directory rotated files are moved into. If empty, backups
+	// are kept next to Filename. A relative path is resolved against the directory
+	// of Filename. Backups are moved with a rename, so BackupDir must be on the
+	// same filesystem as Filename.
+	BackupDir string `json:"backupdir,omitempty" yaml:"backupdir,omitempty"`
+
+	// BackupDirTimeFormat optionally partitions BackupDir by rotation time using a
+	// Go time layout. For example, "2006/01/02" stores a backup rotated on
+	// May 1st 2025 under <BackupDir>/2025/05/01/. Directories left empty by
+	// cleanup are removed. It is ignored if BackupDir is empty.
+	BackupDirTimeFormat string `json:"backupdirtimeformat,omitempty" yaml:"backupdirtimeformat,omitempty"`
+
+	// BackupSequence appends a monotonically increasing sequence number to the
+	// reason of every backup name (<name>-<timestamp>-<reason>-<seq><ext>), so two
+	// rotations that format to the same timestamp (same millisecond, or a coarse
+	// BackupTimeFormat) never overwrite each other. The counter is recovered on
+	// startup from the highest sequence among the existing backups.
+	BackupSequence bool `json:"backupsequence,omitempty" yaml:"backupsequence,omitempty"`
+
+	// ActiveFileTimeFormat, if set, stamps the live file itself with the start time
+	// of its segment using this Go time layout. For example, with "2006-01-02" and
+	// Filename "app.log", logs are written to app-2025-05-01.log (or
+	// app.log-2025-05-01 with AppendTimeAfterExt) and Filename becomes a symlink to
+	// it, atomically retargeted on every rotation. Finalized segments keep their
+	// name instead of being renamed with a reason (they are still moved into
+	// BackupDir if one is set) and are subject to the usual compression and
+	// retention. A segment name that is already taken gets a "-1", "-2", ... suffix.
+	// Requires a filesystem that supports symlinks.
+	ActiveFileTimeFormat string `json:"activefiletimeformat,omitempty" yaml:"activefiletimeformat,omitempty"`
+
+	// FileMode is the permission of new log files, and of the manifest and hash
+	// chain files. It is applied exactly, regardless of the umask. If zero, a new
+	// log file takes the mode of the file it replaces, or 0640 if there is none
+	// (0644 if it's created by a write after Close), subject to the umask.
+	FileMode os.FileMode `json:"filemode,omitempty" yaml:"filemode,omitempty"`
+
+	// ArchiveMode is the permission of compressed and encrypted backups. If zero,
+	// an archive takes the mode of the backup it was made from.
+	ArchiveMode os.FileMode `json:"archivemode,omitempty" yaml:"archivemode,omitempty"`
+
+	// DirMode is the permission of directories created by the Logger: the log
+	// directory, BackupDir and its date directories. If zero, 0755 is used.
+	// Unlike FileMode, it is subject to the umask: directories may be created
+	// several levels at once and may be shared with other programs, so the
+	// Logger leaves their mode to the process, as mkdir -p does.
+	DirMode os.FileMode `json:"dirmode,omitempty" yaml:"dirmode,omitempty"`
+
+	// Owner and Group set the owner and group (names or numeric IDs) of every
+	// file the Logger creates: log files, archives, and the manifest and hash
+	// chain files. If both are empty, new log files and archives take the
+	// ownership of the file they replace. Changing ownership usually requires
+	// privileges; failures are reported on stderr. Only supported on Linux.
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+
+	// Header, if set, is called whenever a new log file is created, and what it
+	// returns is written at the start of the file (e.g. a metadata line ending
+	// in a newline). It is not called when an existing file is reopened.
+	Header func(info SegmentInfo) []byte `json:"-" yaml:"-"`
+
+	// Footer, if set, is called when the current file is rotated, and what it
+	// returns is appended to the file before it's closed, so a missing footer
+	// reveals a truncated file. It is only called for files this Logger has
+	// open (including on Close with RotateOnClose). The footer may take the file
+	// slightly past MaxSize. It's written once per file: if the rotation then
+	// fails, the next write retries it before writing anything.
+	Footer func(info SegmentInfo) []byte `json:"-" yaml:"-"`
+
+	// SyncPolicy controls when written data is committed to stable storage (fsync):
+	//   "none" (default): never, the OS writes data back on its own schedule
+	//   "write":          after every Write
+	//   "bytes":          once SyncEveryBytes bytes were written since the last sync
+	//   "interval":       at most SyncInterval after a Write
+	//   "rotate":         only around rotations
+	// Every policy other than "none" also syncs on rotation: the closing file before
+	// it is renamed, and the affected directories after the rename, the creation of
+	// the new file, and compression or removal of backups. Close syncs the file too.
+	// Unknown values => "none" (with a warning).
+	SyncPolicy string `json:"syncpolicy,omitempty" yaml:"syncpolicy,omitempty"`
+
+	// SyncEveryBytes is the number of bytes between syncs for SyncPolicy "bytes".
+	// Values <= 0 => 1 MiB (with a warning).
+	SyncEveryBytes int64 `json:"synceverybytes,omitempty" yaml:"synceverybytes,omitempty"`
+
+	// SyncInterval is the time between syncs for SyncPolicy "interval". A Write
+	// syncs if the last sync is at least this old; otherwise a timer (on the
+	// Manager's scheduler if the Logger has one) syncs it once it is, so the
+	// last writes before a quiet period are synced too. Values <= 0 => 1s (with
+	// a warning).
+	SyncInterval time.Duration `json:"syncinterval,omitempty" yaml:"syncinterval,omitempty"`
+
+	// FallbackWriter, if set, receives what can't be written to the log file,
+	// e.g. because its volume is full or read-only. It can be os.Stderr or a
+	// spill file on another volume. While the log file is unavailable, Write
+	// succeeds as long as FallbackWriter does, and the log file is only tried
+	// again after a backoff (see RetryBackoff). Once a retry succeeds, writes go
+	// back to the log file. Only failures to create, open, write or sync the
+	// file count; other errors, e.g. of a rotation that can't rename the file,
+	// are returned by Write as they are.
+	FallbackWriter io.Writer `json:"-" yaml:"-"`
+
+	// RetryBackoff is how long Write waits after the log file failed before it
+	// tries it again. It doubles after every failed retry, up to MaxRetryBackoff.
+	// Writes in between go to FallbackWriter, or fail with ErrUnavailable if there
+	// is none. Setting FallbackWriter or RetryBackoff enables this behavior;
+	// without either, every Write tries the log file. If zero, 1 second is used.
+	RetryBackoff time.Duration `json:"retrybackoff,omitempty" yaml:"retrybackoff,omitempty"`
+
+	// MaxRetryBackoff caps the backoff between retries. If zero, 1 minute is used.
+	MaxRetryBackoff time.Duration `json:"maxretrybackoff,omitempty" yaml:"maxretrybackoff,omitempty"`
+
+	// OutageCallback, if set, is called when the log file becomes unavailable and
+	// when it recovers, with the state of the outage (see Outage). It is called
+	// from Write after the Logger's lock is released, so it may write to the Logger.
+	OutageCallback func(OutageStats) `json:"-" yaml:"-"`
+
 	// callback function for available log files
 	// dir is the directory of the log files
 	// logFiles are the names of the finalized log files
 	Callback func(dir string, logFiles []string)
 
-	// Perform rotation when close
+	// Perform rotation when close. The file is only moved aside: no new file
+	// is created, so there is no live file until the next write.
 	RotateOnClose bool
 
 	// always delete zero size log files
 	DeleteZeroSizeLog bool
 
+	// SkipEmptyRotation makes time-based rotations (scheduled, interval and
+	// manual) no-ops while nothing but the header was written to the current
+	// file, so no empty backups are made. A reopened existing file only counts
+	// as empty if it has no bytes at all, header included.
+	SkipEmptyRotation bool `json:"skipemptyrotation,omitempty" yaml:"skipemptyrotation,omitempty"`
+
+	// IdleTimeout, if set, rotates the log file with reason "idle" once it has
+	// gone this long without writes, so that log shippers can pick up the last
+	// segment. Files without data are not rotated (see SkipEmptyRotation). The
+	// checks run on the Manager's scheduler if the Logger has one.
+	IdleTimeout time.Duration `json:"idletimeout,omitempty" yaml:"idletimeout,omitempty"`
+
 	// Internal fields
 	size             int64     // current size of the log file
+	lines            int64     // current number of lines of the log file, if MaxLines is set
+	headerSize       int64     // size of the header written to the current file
+	footerReason     string    // reason of a rotation that failed after writing the footer
 	file             *os.File  // current log file
 	lastRotationTime time.Time // records the last time a rotation happened (for interval/scheduled).
 	logStartTime     time.Time // start time of the current logging period (used for backup filename timestamp).
@@ -192,14 +465,80 @@ type Logger struct {
 	mu sync.Mutex // ensures atomic writes and rotations
 
 	// For mill goroutine (backups, compression cleanup)
-	millCh    chan bool // channel to signal the mill goroutine
-	startMill sync.Once // ensures mill goroutine is started only once
+	millCh      chan bool      // channel to signal the mill goroutine
+	startMill   sync.Once      // ensures mill goroutine is started only once
+	millWg      sync.WaitGroup // waits for the mill goroutine, or the passes queued with the manager
+	millMu      sync.Mutex     // serializes mill passes
+	millStopped uint32         // set when Shutdown gave up waiting; stops compressing
+
+	manager *Manager // set by Manager.Add; runs the scheduled rotations and the mill instead
 
 	// For scheduled rotation goroutine (RotateAt)
 	startScheduledRotationOnce sync.Once      // ensures scheduled rotation goroutine is started only once
 	scheduledRotationQuitCh    chan struct{}  // channel to signal the scheduled rotation goroutine to stop
 	scheduledRotationWg        sync.WaitGroup // waits for the scheduled rotation goroutine to finish
 	processedRotateAt          []rotateAt     // internal storage for sorted and validated RotateAt
+	dstGapPolicy               string         // validated DSTGapPolicy
+	dstOverlapPolicy           string         // validated DSTOverlapPolicy
+
+	recoverOnce sync.Once // ensures crash recovery of compressions runs only once
+
+	// For Owner and Group
+	ownershipOnce sync.Once // ensures Owner and Group are resolved only once
+	uid, gid      int       // resolved Owner and Group, -1 if unset
+
+	// For Manifest
+	manifestMu    sync.Mutex       // serializes appends from rotations and the mill, guards unrecorded
+	segmentHash   hash.Hash        // SHA-256 of the current file, if it was created by us
+	segmentHashed int64            // number of bytes in segmentHash
+	unrecorded    []rotationRecord // rotations left to the mill to record, oldest first
+
+	// For HashChain
+	chainMu     sync.Mutex // serializes appends from rotations and the mill
+	chainLoaded bool       // chainSeq and chainHead were read from the chain file
+	chainSeq    int        // sequence number of the last link
+	chainHead   string     // digest of the last link
+
+	// For IdleTimeout
+	idleTimer     *time.Timer // fires IdleTimeout after it was armed, without a Manager
+	idleArmed     bool        // idleTimer is pending
+	lastWriteTime time.Time   // time of the last Write to the current file
+
+	// For MinRotationInterval
+	minRotationPolicyOnce sync.Once     // ensures MinRotationPolicy is validated only once
+	minRotationPolicy     string        // validated MinRotationPolicy
+	closeCh               chan struct{} // closed by Close, ends waits of blocked writes
+	startEstimate         time.Time     // probable start of a reopened file, if logStartTime is unknown
+	suppressedRotations   int64         // rotations suppressed or delayed by MinRotationInterval
+
+	// For SyncPolicy
+	syncPolicyOnce sync.Once     // ensures SyncPolicy is validated only once
+	syncPolicy     string        // validated SyncPolicy
+	syncEveryBytes int64         // validated SyncEveryBytes
+	syncInterval   time.Duration // validated SyncInterval
+	unsyncedBytes  int64         // bytes written since the last sync
+	lastSyncTime   time.Time     // time of the last sync
+	syncTimer      *time.Timer   // fires when unsynced writes are due for SyncPolicy "interval", without a Manager
+	syncArmed      bool          // a sync is pending on syncTimer or the Manager
+
+	// For FallbackWriter and RetryBackoff
+	outage        OutageStats   // current or last outage
+	outageBackoff time.Duration // delay between the last failure and the next retry
+	outageRetryAt time.Time     // time of the next retry
+	outageEvents  []OutageStats // pending OutageCallback calls
+	outagePending int32         // outageEvents is not empty
+
+	// For TimeZone
+	timeZoneOnce sync.Once      // ensures TimeZone is resolved only once
+	timeZoneLoc  *time.Location // resolved TimeZone, nil if invalid
+
+	// For BackupSequence
+	backupSeq       int  // last sequence number used in a backup name
+	backupSeqLoaded bool // backupSeq has been recovered from existing backups
+
+	// For ActiveFileTimeFormat: path of the live time-stamped file (string).
+	// Read by the mill without holding mu.
+	activePath atomic.Value
 
 	// isBackupTimeFormatValidated flag helps prevent repeated validation checks
 	// on supplied format through configuration
@@ -223,8 +562,26 @@ var (
 
 	osRemove = os.Remove
 
+	// fileSync exists so it can be mocked out by tests.
+	fileSync = (*os.File).Sync
+
+	// sleep waits for d, or until quit is closed. It exists so it can be
+	// mocked out by tests.
+	sleep = func(d time.Duration, quit <-chan struct{}) {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-quit:
+		}
+	}
+
 	// empty BackupTimeFormatField
 	ErrEmptyBackupTimeFormatField = errors.New("empty backupformat field")
+
+	// ErrUnavailable is returned by Write when the log file can't be written and
+	// there is no FallbackWriter, or it failed too (see RetryBackoff).
+	ErrUnavailable = errors.New("timberjack: log file unavailable")
 )
 
 // Write implements io.Writer.
@@ -235,29 +592,72 @@ var (
 // using the original filename.
 // If the size of a single write exceeds MaxSize, the write is rejected and an error is returned.
 func (l *Logger) Write(p []byte) (n int, err error) {
+	defer l.notifyOutage() // runs after mu is released
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.waitForRotation(p)
 
 	// Handle writes to a closed logger.
 	if atomic.LoadUint32(&l.isClosed) == 1 {
-		// The logger is closed. To ensure the write succeeds, we perform a
-		// single open-write-close cycle. This does not perform rotation
-		// and does not restart the background goroutines. l.file remains nil.
-		file, openErr := os.OpenFile(l.filename(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-		if openErr != nil {
-			return 0, fmt.Errorf("timberjack: write on closed logger failed to open file: %w", openErr)
-		}
+		return l.writeClosed(p)
+	}
+	return l.writeOpen(p)
+}
+
+// writeOpen writes p to an open Logger. It expects l.mu to be held.
+func (l *Logger) writeOpen(p []byte) (int, error) {
+	if l.FallbackWriter != nil || l.RetryBackoff > 0 {
+		return l.writeDegraded(p)
+	}
+	return l.write(p)
+}
 
-		n, writeErr := file.Write(p)
+// writeIfOpen is like Write, but doesn't write to a closed Logger: it reports
+// whether the Logger was open instead.
+func (l *Logger) writeIfOpen(p []byte) (n int, open bool, err error) {
+	defer l.notifyOutage() // runs after mu is released
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waitForRotation(p)
 
-		closeErr := file.Close()
+	if atomic.LoadUint32(&l.isClosed) == 1 {
+		return 0, false, nil
+	}
+	n, err = l.writeOpen(p)
+	return n, true, err
+}
 
-		if writeErr != nil {
-			return n, writeErr
-		}
-		return n, closeErr
+// writeClosed writes p to the file of a closed Logger. It expects l.mu to be held.
+func (l *Logger) writeClosed(p []byte) (int, error) {
+	// To ensure the write succeeds, we perform a single open-write-close
+	// cycle. This does not perform rotation and does not restart the
+	// background goroutines. l.file remains nil.
+	mode := os.FileMode(0644) // as before FileMode existed
+	if l.FileMode != 0 {
+		mode = l.FileMode
 	}
+	_, statErr := os.Stat(l.filename())
+	file, openErr := os.OpenFile(l.filename(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, mode)
+	if openErr != nil {
+		return 0, fmt.Errorf("timberjack: write on closed logger failed to open file: %w", openErr)
+	}
+	if os.IsNotExist(statErr) {
+		l.setPermissions(file.Name(), l.FileMode, nil)
+	}
+
+	n, writeErr := file.Write(p)
+
+	closeErr := file.Close()
 
+	if writeErr != nil {
+		return n, writeErr
+	}
+	return n, closeErr
+}
+
+// write writes p to the log file, rotating it first if needed. It expects
+// l.mu to be held.
+func (l *Logger) write(p []byte) (n int, err error) {
 	// Ensure the scheduled-rotation goroutine is running (if you've still got one).
 	l.ensureScheduledRotationLoopRunning()
 
@@ -274,51 +674,561 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 		if err = l.openExistingOrNew(len(p)); err != nil {
 			return 0, err
 		}
-		if l.lastRotationTime.IsZero() {
-			// Initialize to 'now' so interval/minute checks start from here.
-			l.lastRotationTime = now
+	}
+	if l.lastRotationTime.IsZero() {
+		// Initialize to 'now' so interval/minute checks start from here.
+		l.lastRotationTime = now
+	}
+
+	// 0) A rotation that failed after writing the footer: finish it first, so
+	// that nothing is written after the footer.
+	if l.footerReason != "" {
+		if err := l.rotate(l.footerReason); err != nil {
+			return 0, fmt.Errorf("rotation failed: %w", err)
 		}
 	}
 
 	// 1) Interval-based rotation
 	if l.RotationInterval > 0 && now.Sub(l.lastRotationTime) >= l.RotationInterval {
-		if err := l.rotate("time"); err != nil {
-			return 0, fmt.Errorf("interval rotation failed: %w", err)
+		if !l.skipRotation() {
+			if err := l.rotate("time"); err != nil {
+				return 0, fmt.Errorf("interval rotation failed: %w", err)
+			}
 		}
 		l.lastRotationTime = now
 	}
 
 	// 2) Scheduled time based rotation (RotateAt)
 	if len(l.processedRotateAt) > 0 {
-		for _, m := range l.processedRotateAt {
-			mark := time.Date(now.Year(), now.Month(), now.Day(),
-				m[0], m[1], 0, 0, l.location())
-			// If we've crossed that mark since the last rotation, fire one rotation.
-			if l.lastRotationTime.Before(mark) && (mark.Before(now) || mark.Equal(now)) {
+		// If we've crossed one of today's marks since the last rotation, fire one rotation.
+		if mark, due := dueScheduledMark(l.lastRotationTime, now, l.processedRotateAt, l.location(), l.dstGapPolicy, l.dstOverlapPolicy); due {
+			if !l.skipRotation() {
 				if err := l.rotate("time"); err != nil {
 					return 0, fmt.Errorf("scheduled-minute rotation failed: %w", err)
 				}
-				// Record the logical mark—so we don’t rerun until next slot.
-				l.lastRotationTime = mark
-				break
 			}
+			// Record the logical mark—so we don’t rerun until next slot.
+			l.lastRotationTime = mark
 		}
 	}
 
-	// 3) Size-based rotation
-	if l.size+writeLen > l.max() {
-		if err := l.rotate("size"); err != nil {
+	// 3) Size-based, or 4) line-based rotation
+	// Note: we leave lastRotationTime untouched for these rotations.
+	if reason := l.rotationReason(p); reason != "" && !l.holdRotation() {
+		if err := l.rotate(reason); err != nil {
+			if reason == "lines" {
+				return 0, fmt.Errorf("line rotation failed: %w", err)
+			}
 			return 0, fmt.Errorf("size rotation failed: %w", err)
 		}
-		// Note: we leave lastRotationTime untouched for size rotations.
 	}
 
 	// Finally, write the bytes and update size.
-	n, err = l.file.Write(p)
+	n, err = l.writeFile(p)
+	l.size += int64(n)
+	if l.MaxLines > 0 {
+		l.lines += int64(bytes.Count(p[:n], newline))
+	}
+	if l.IdleTimeout > 0 && n > 0 {
+		l.lastWriteTime = now
+		l.armIdleTimer()
+	}
+	if err != nil {
+		return n, &fileError{err}
+	}
+	if err := l.syncAfterWrite(now, n); err != nil {
+		return n, &fileError{fmt.Errorf("sync failed: %w", err)}
+	}
+	return n, nil
+}
+
+// writeFooter appends the Footer to the current file, if both exist, ahead of
+// a rotation for reason. Failures are reported but don't stop the rotation.
+// The footer is written once: if the rotation fails, the file keeps it and the
+// rotation is retried before anything else is written (see write).
+// It expects l.mu to be held.
+func (l *Logger) writeFooter(reason string) {
+	if l.Footer == nil || l.file == nil || l.footerReason != "" {
+		return
+	}
+	l.footerReason = reason
+	footer := l.Footer(SegmentInfo{
+		Filename: l.file.Name(),
+		Start:    l.logStartTime,
+		End:      currentTime(),
+		Size:     l.size,
+		Reason:   reason,
+	})
+	n, err := l.writeFile(footer)
 	l.size += int64(n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to write footer: %v\n", l.Filename, err)
+	}
+}
+
+// writeFile writes p to the current file, keeping the checksum of the
+// current file up to date. It expects l.mu to be held.
+func (l *Logger) writeFile(p []byte) (int, error) {
+	n, err := l.file.Write(p)
+	if l.segmentHash != nil {
+		l.segmentHash.Write(p[:n])
+		l.segmentHashed += int64(n)
+	}
 	return n, err
 }
 
+// skipRotation reports whether a time-based rotation should be skipped
+// because of SkipEmptyRotation. It expects l.mu to be held.
+func (l *Logger) skipRotation() bool {
+	if !l.SkipEmptyRotation {
+		return false
+	}
+	if l.file != nil {
+		return l.size <= l.headerSize
+	}
+	info, err := osStat(l.filename())
+	return os.IsNotExist(err) || (err == nil && info.Size() == 0)
+}
+
+// armIdleTimer makes sure rotateIfIdle runs IdleTimeout after the last write.
+// It expects l.mu to be held.
+func (l *Logger) armIdleTimer() {
+	if l.idleArmed {
+		return // rotateIfIdle re-arms it for the remaining time
+	}
+	l.idleArmed = true
+	l.startTimer(&l.idleTimer, timerIdle, l.IdleTimeout)
+}
+
+// startTimer makes the check of the given kind run after d: on the scheduler
+// of the Manager if l has one, or else on *timer, which is created on first
+// use. It expects l.mu to be held.
+func (l *Logger) startTimer(timer **time.Timer, kind timerKind, d time.Duration) {
+	if l.manager != nil {
+		l.manager.scheduleCheck(l, kind, currentTime().Add(d))
+		return
+	}
+	if *timer == nil {
+		*timer = time.AfterFunc(d, func() { l.runCheck(kind) })
+	} else {
+		(*timer).Reset(d)
+	}
+}
+
+// runCheck runs the check of the given kind, when its timer fires.
+func (l *Logger) runCheck(kind timerKind) {
+	switch kind {
+	case timerIdle:
+		l.rotateIfIdle()
+	case timerSync:
+		l.syncIfDue()
+	}
+}
+
+// rotateIfIdle rotates the log file with reason "idle" if it hasn't been
+// written to for IdleTimeout.
+func (l *Logger) rotateIfIdle() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.idleArmed = false
+	if atomic.LoadUint32(&l.isClosed) == 1 || l.file == nil {
+		return
+	}
+	now := currentTime()
+	if idle := now.Sub(l.lastWriteTime); idle < l.IdleTimeout {
+		l.idleArmed = true
+		l.startTimer(&l.idleTimer, timerIdle, l.IdleTimeout-idle)
+		return
+	}
+	if l.size <= l.headerSize {
+		return // nothing to finalize; the next write arms the timer again
+	}
+	if err := l.rotate("idle"); err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] idle rotation failed: %v\n", l.Filename, err)
+		return
+	}
+	l.lastRotationTime = now
+}
+
+// rotationReason returns the reason of the rotation needed before writing p
+// to the current file: "size" or "lines", or "" if none is.
+// It expects l.mu to be held.
+func (l *Logger) rotationReason(p []byte) string {
+	switch {
+	case l.size+int64(len(p)) > l.max():
+		return "size"
+	case l.MaxLines > 0 && l.lines > 0 && l.lines+int64(bytes.Count(p, newline)) > int64(l.MaxLines):
+		return "lines"
+	default:
+		return ""
+	}
+}
+
+// rotationWait returns how long a size or line rotation must wait until the
+// current file is MinRotationInterval old, or 0 if it may happen now.
+// It expects l.mu to be held.
+func (l *Logger) rotationWait() time.Duration {
+	if l.MinRotationInterval <= 0 {
+		return 0
+	}
+	start := l.logStartTime
+	if start.IsZero() {
+		start = l.startEstimate // a reopened file
+	}
+	return max(start.Add(l.MinRotationInterval).Sub(currentTime()), 0)
+}
+
+// estimateStart returns when the existing log file described by info was
+// probably started, for MinRotationInterval: at the newest backup, i.e. the
+// rotation that started it, or else at its last modification.
+func (l *Logger) estimateStart(info os.FileInfo) time.Time {
+	start := info.ModTime()
+	if files, err := l.oldLogFiles(); err == nil && len(files) > 0 && files[0].timestamp.Before(start) {
+		start = files[0].timestamp // files is sorted newest first
+	}
+	if now := currentTime(); now.Before(start) {
+		start = now
+	}
+	return start
+}
+
+// holdRotation reports whether a size or line rotation must be suppressed
+// because the current file is younger than MinRotationInterval, with
+// MinRotationPolicy "grow". It expects l.mu to be held.
+func (l *Logger) holdRotation() bool {
+	if l.rotationWait() == 0 || l.effectiveMinRotationPolicy() != rotationGrow {
+		return false // "block" waited in waitForRotation
+	}
+	l.suppressedRotations++
+	return true
+}
+
+// waitForRotation waits, with MinRotationPolicy "block", until the file may
+// be rotated if writing p needs it, or until the Logger is closed. l.mu is
+// released while waiting. It expects l.mu to be held.
+func (l *Logger) waitForRotation(p []byte) {
+	if l.MinRotationInterval <= 0 || l.effectiveMinRotationPolicy() != rotationBlock {
+		return
+	}
+	if l.file == nil && atomic.LoadUint32(&l.isClosed) == 0 && !l.outage.Active && int64(len(p)) <= l.max() {
+		// Open the file first to know its size and age, e.g. after a restart.
+		if err := l.openExistingOrNew(len(p)); err != nil {
+			return // write tries again and reports it
+		}
+	}
+	counted := false
+	for l.file != nil && atomic.LoadUint32(&l.isClosed) == 0 && l.rotationReason(p) != "" {
+		wait := l.rotationWait()
+		if wait == 0 {
+			return
+		}
+		if !counted {
+			l.suppressedRotations++
+			counted = true
+		}
+		if l.closeCh == nil {
+			l.closeCh = make(chan struct{})
+		}
+		closeCh := l.closeCh
+		l.mu.Unlock()
+		sleep(wait, closeCh)
+		l.mu.Lock()
+	}
+}
+
+// effectiveMinRotationPolicy returns the validated MinRotationPolicy.
+func (l *Logger) effectiveMinRotationPolicy() string {
+	l.minRotationPolicyOnce.Do(func() {
+		l.minRotationPolicy = validPolicy("MinRotationPolicy", l.MinRotationPolicy, rotationGrow, rotationBlock)
+	})
+	return l.minRotationPolicy
+}
+
+// SuppressedRotations returns the number of writes that would have rotated
+// the log file, but were kept in it or delayed because of MinRotationInterval.
+func (l *Logger) SuppressedRotations() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.suppressedRotations
+}
+
+// newline is what MaxLines counts.
+var newline = []byte{'\n'}
+
+// countLines returns the number of newlines in the file name.
+func countLines(name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var lines int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		lines += int64(bytes.Count(buf[:n], newline))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+// OutageStats describes an outage of the log file: a period in which it
+// couldn't be written, so writes were diverted to FallbackWriter or lost.
+type OutageStats struct {
+	Active        bool      // the outage is ongoing
+	Start         time.Time // time of the first failure
+	End           time.Time // time of the recovery, zero while Active
+	Err           error     // last error of the log file
+	Retries       int       // failed attempts to write the log file again
+	DivertedBytes int64     // bytes written to FallbackWriter
+	LostBytes     int64     // bytes written neither to the log file nor to FallbackWriter
+}
+
+// Outage returns the state of the current outage, or of the last one if the
+// log file has recovered. It is the zero value if there was no outage.
+func (l *Logger) Outage() OutageStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.outage
+}
+
+// writeDegraded is write for Loggers with a FallbackWriter or RetryBackoff: it
+// diverts p while the log file is unavailable, and only retries the log file
+// once the backoff has passed. It expects l.mu to be held.
+func (l *Logger) writeDegraded(p []byte) (int, error) {
+	if int64(len(p)) > l.max() {
+		return l.write(p) // rejected; not an outage
+	}
+	now := currentTime()
+	if l.outage.Active && now.Before(l.outageRetryAt) {
+		return l.divert(p, l.outage.Err)
+	}
+
+	n, err := l.write(p)
+	var fe *fileError
+	if err != nil && !errors.As(err, &fe) {
+		return n, err // e.g. a failed rename: the file itself is fine
+	}
+	if err == nil {
+		if l.outage.Active {
+			l.outage.Active = false
+			l.outage.End = now
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] log file recovered after %v (%d bytes diverted, %d bytes lost)\n",
+				l.Filename, now.Sub(l.outage.Start), l.outage.DivertedBytes, l.outage.LostBytes)
+			l.queueOutageEvent()
+		}
+		return n, nil
+	}
+
+	started := !l.outage.Active
+	l.failOutage(now, err)
+	m := 0
+	if n < len(p) {
+		m, err = l.divert(p[n:], err)
+	} // else only the sync failed: p is in the file, but it's not durable
+	if started {
+		l.queueOutageEvent()
+	}
+	return n + m, err
+}
+
+// fileError is a failure to open, write or sync the log file, which
+// writeDegraded treats as an outage, unlike other errors of Write (e.g. a
+// rotation that failed to rename the file).
+type fileError struct{ err error }
+
+func (e *fileError) Error() string { return e.err.Error() }
+func (e *fileError) Unwrap() error { return e.err }
+
+// failOutage records a failure of the log file at now, starting an outage if
+// there is none, and schedules the next retry. It expects l.mu to be held.
+func (l *Logger) failOutage(now time.Time, err error) {
+	// Reopen the file on the next attempt, in case its volume was remounted.
+	_ = l.closeFile()
+
+	maxBackoff := l.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxRetryBackoff
+	}
+	if l.outage.Active {
+		l.outage.Err = err
+		l.outage.Retries++
+		l.outageBackoff = min(2*l.outageBackoff, maxBackoff)
+	} else {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] log file unavailable: %v\n", l.Filename, err)
+		l.outage = OutageStats{Active: true, Start: now, Err: err}
+		l.outageBackoff = l.RetryBackoff
+		if l.outageBackoff <= 0 {
+			l.outageBackoff = defaultRetryBackoff
+		}
+		l.outageBackoff = min(l.outageBackoff, maxBackoff)
+	}
+	l.outageRetryAt = now.Add(l.outageBackoff)
+}
+
+// divert writes p, which couldn't be written to the log file because of cause,
+// to FallbackWriter, and accounts for it in the outage. It expects l.mu to be held.
+func (l *Logger) divert(p []byte, cause error) (int, error) {
+	if l.FallbackWriter == nil {
+		l.outage.LostBytes += int64(len(p))
+		return 0, fmt.Errorf("%w: %w", ErrUnavailable, cause)
+	}
+	n, err := l.FallbackWriter.Write(p)
+	l.outage.DivertedBytes += int64(n)
+	l.outage.LostBytes += int64(len(p) - n)
+	if err != nil {
+		return n, fmt.Errorf("%w: %w (fallback writer: %v)", ErrUnavailable, cause, err)
+	}
+	return n, nil
+}
+
+// queueOutageEvent queues a call of OutageCallback with the current state of
+// the outage. It expects l.mu to be held.
+func (l *Logger) queueOutageEvent() {
+	if l.OutageCallback == nil {
+		return
+	}
+	l.outageEvents = append(l.outageEvents, l.outage)
+	atomic.StoreInt32(&l.outagePending, 1)
+}
+
+// notifyOutage calls OutageCallback for the queued events. It must be called
+// without holding l.mu.
+func (l *Logger) notifyOutage() {
+	if atomic.LoadInt32(&l.outagePending) == 0 {
+		return
+	}
+	l.mu.Lock()
+	events := l.outageEvents
+	l.outageEvents = nil
+	atomic.StoreInt32(&l.outagePending, 0)
+	l.mu.Unlock()
+	for _, e := range events {
+		l.OutageCallback(e)
+	}
+}
+
+// Sync commits the current contents of the log file to stable storage.
+// Together with Write, this lets a Logger be used as a zapcore.WriteSyncer.
+func (l *Logger) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.syncFile()
+}
+
+// syncFile fsyncs the current file, if any. It expects l.mu to be held.
+func (l *Logger) syncFile() error {
+	if l.file == nil {
+		return nil
+	}
+	l.unsyncedBytes = 0
+	l.lastSyncTime = currentTime()
+	return fileSync(l.file)
+}
+
+// syncAfterWrite applies SyncPolicy after n bytes were written at now.
+// It expects l.mu to be held.
+func (l *Logger) syncAfterWrite(now time.Time, n int) error {
+	l.unsyncedBytes += int64(n)
+	switch l.effectiveSyncPolicy() {
+	case syncWrite:
+		return l.syncFile()
+	case syncBytes:
+		if l.unsyncedBytes >= l.syncEveryBytes {
+			return l.syncFile()
+		}
+	case syncInterval:
+		if l.lastSyncTime.IsZero() {
+			l.lastSyncTime = now // start counting from the first write
+		}
+		wait := l.lastSyncTime.Add(l.syncInterval).Sub(now)
+		if wait <= 0 {
+			return l.syncFile()
+		}
+		l.armSyncTimer(wait)
+	}
+	return nil
+}
+
+// armSyncTimer makes sure syncIfDue runs after d. It expects l.mu to be held.
+func (l *Logger) armSyncTimer(d time.Duration) {
+	if l.syncArmed {
+		return // syncIfDue re-arms it if it fires early
+	}
+	l.syncArmed = true
+	l.startTimer(&l.syncTimer, timerSync, d)
+}
+
+// syncIfDue syncs the writes that have waited SyncInterval for SyncPolicy
+// "interval" without another Write to sync them.
+func (l *Logger) syncIfDue() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncArmed = false
+	if atomic.LoadUint32(&l.isClosed) == 1 || l.file == nil || l.unsyncedBytes == 0 {
+		return
+	}
+	if wait := l.lastSyncTime.Add(l.syncInterval).Sub(currentTime()); wait > 0 {
+		l.armSyncTimer(wait)
+		return
+	}
+	if err := l.syncFile(); err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to sync log file: %v\n", l.Filename, err)
+	}
+}
+
+// effectiveSyncPolicy returns the validated SyncPolicy, and validates
+// SyncEveryBytes and SyncInterval if the policy uses them.
+func (l *Logger) effectiveSyncPolicy() string {
+	l.syncPolicyOnce.Do(func() {
+		l.syncPolicy = validPolicy("SyncPolicy", l.SyncPolicy, syncNone, syncWrite, syncBytes, syncInterval, syncRotate)
+		l.syncEveryBytes, l.syncInterval = l.SyncEveryBytes, l.SyncInterval
+		if l.syncPolicy == syncBytes && l.syncEveryBytes <= 0 {
+			fmt.Fprintf(os.Stderr, "timberjack: invalid SyncEveryBytes %d — using %d\n", l.SyncEveryBytes, defaultSyncEveryBytes)
+			l.syncEveryBytes = defaultSyncEveryBytes
+		}
+		if l.syncPolicy == syncInterval && l.syncInterval <= 0 {
+			fmt.Fprintf(os.Stderr, "timberjack: invalid SyncInterval %v — using %v\n", l.SyncInterval, defaultSyncInterval)
+			l.syncInterval = defaultSyncInterval
+		}
+	})
+	return l.syncPolicy
+}
+
+// syncOnRotate reports whether rotations should be made durable.
+func (l *Logger) syncOnRotate() bool {
+	return l.effectiveSyncPolicy() != syncNone
+}
+
+// syncDirIfNeeded fsyncs dir if rotations should be made durable, reporting
+// (but otherwise ignoring) failures.
+func (l *Logger) syncDirIfNeeded(dir string) {
+	if !l.syncOnRotate() {
+		return
+	}
+	if err := syncDir(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to sync directory %s: %v\n", l.Filename, dir, err)
+	}
+}
+
+// syncDir fsyncs a directory so that renames, creations and removals of its
+// entries are durable. It is a no-op on Windows, which can't sync directories.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
 // ValidateBackupTimeFormat checks if the configured BackupTimeFormat is a valid time layout.
 // While other formats are allowed, it is recommended to follow the standard time layout
 // rules as defined here: https://pkg.go.dev/time#pkg-constants
@@ -350,8 +1260,25 @@ func (l *Logger) ValidateBackupTimeFormat() error {
 	return nil
 }
 
-// location returns the time.Location (UTC or Local) to use for timestamps in backup filenames.
+// location returns the time.Location to use for timestamps in backup filenames and
+// for scheduling: Location if set, then TimeZone, then UTC or Local per LocalTime.
 func (l *Logger) location() *time.Location {
+	if l.Location != nil {
+		return l.Location
+	}
+	if l.TimeZone != "" {
+		l.timeZoneOnce.Do(func() {
+			loc, err := time.LoadLocation(l.TimeZone)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "timberjack: invalid TimeZone %q: %v — falling back to LocalTime\n", l.TimeZone, err)
+				return
+			}
+			l.timeZoneLoc = loc
+		})
+		if l.timeZoneLoc != nil {
+			return l.timeZoneLoc
+		}
+	}
 	if l.LocalTime {
 		return time.Local
 	}
@@ -430,6 +1357,12 @@ func (l *Logger) ensureScheduledRotationLoopRunning() {
 		})
 
 		l.processedRotateAt = processedRotateAt
+		l.dstGapPolicy = validPolicy("DSTGapPolicy", l.DSTGapPolicy, dstShift, dstSkip)
+		l.dstOverlapPolicy = validPolicy("DSTOverlapPolicy", l.DSTOverlapPolicy, dstFirst, dstLast, dstBoth)
+		if l.manager != nil {
+			l.manager.schedule(l, currentTime())
+			return
+		}
 		l.scheduledRotationQuitCh = make(chan struct{})
 		l.scheduledRotationWg.Add(1)
 		go l.runScheduledRotations()
@@ -458,27 +1391,11 @@ func (l *Logger) runScheduledRotations() {
 	for {
 		now := currentTime() // Use the mockable currentTime for testability
 		nowInLocation := now.In(l.location())
-		nextRotationAbsoluteTime := time.Time{}
-		foundNextSlot := false
-
-	determineNextSlot:
-		// Calculate the next rotation time based on the current time and processedRotateAt.
-		// Iterate through the current hour, then subsequent hours (up to 24h ahead for robustness
-		// against system sleep or large clock jumps).
-		for hourOffset := 0; hourOffset <= 24; hourOffset++ {
-			// Base time for the hour we are checking (e.g., if now is 10:35, current hour base is 10:00)
-			hourToCheck := time.Date(nowInLocation.Year(), nowInLocation.Month(), nowInLocation.Day(), nowInLocation.Hour(), 0, 0, 0, l.location()).Add(time.Duration(hourOffset) * time.Hour)
-
-			for _, mark := range l.processedRotateAt { // l.processedRotateAt is sorted
-				candidateTime := time.Date(hourToCheck.Year(), hourToCheck.Month(), hourToCheck.Day(), mark[0], mark[1], 0, 0, l.location())
-
-				if candidateTime.After(now) { // Found the earliest future slot
-					nextRotationAbsoluteTime = candidateTime
-					foundNextSlot = true
-					break determineNextSlot // Exit both loops
-				}
-			}
-		}
+
+		// Calculate the next rotation time based on the current time and processedRotateAt,
+		// walking calendar days (not fixed 24h steps) so DST transitions are handled
+		// according to DSTGapPolicy and DSTOverlapPolicy.
+		nextRotationAbsoluteTime, foundNextSlot := nextScheduledRotation(now, l.processedRotateAt, l.location(), l.dstGapPolicy, l.dstOverlapPolicy)
 
 		if !foundNextSlot {
 			// This should ideally not happen if processedRotateAt is valid and non-empty.
@@ -498,18 +1415,7 @@ func (l *Logger) runScheduledRotations() {
 
 		select {
 		case <-timer.C: // Timer fired, it's time for a scheduled rotation
-			l.mu.Lock()
-			// Only rotate if the last rotation time was before this specific scheduled mark.
-			// This prevents redundant rotations if another rotation (e.g., size/interval) happened
-			// very close to, but just before or at, this scheduled time for the same mark.
-			if l.lastRotationTime.Before(nextRotationAbsoluteTime) {
-				if err := l.rotate("time"); err != nil { // Scheduled rotations are "time" based for filename
-					fmt.Fprintf(os.Stderr, "timberjack: [%s] scheduled rotation failed: %v\n", l.Filename, err)
-				} else {
-					l.lastRotationTime = currentTime() // Update lastRotationTime after successful scheduled rotation
-				}
-			}
-			l.mu.Unlock()
+			l.rotateAtMark(nextRotationAbsoluteTime)
 			// Loop will continue and recalculate the next slot from the new "now"
 
 		case <-l.scheduledRotationQuitCh: // Signal to quit from Close()
@@ -526,17 +1432,258 @@ func (l *Logger) runScheduledRotations() {
 	}
 }
 
-// Close implements io.Closer, and closes the current logfile.
-// It also signals any running goroutines (like scheduled rotation or mill) to stop.
-func (l *Logger) Close() error {
+// rotateAtMark performs the scheduled rotation for mark.
+func (l *Logger) rotateAtMark(mark time.Time) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-
 	if atomic.LoadUint32(&l.isClosed) == 1 {
-		return nil // Already closed
+		return
 	}
-
+	// Only rotate if the last rotation time was before this specific scheduled mark.
+	// This prevents redundant rotations if another rotation (e.g., size/interval) happened
+	// very close to, but just before or at, this scheduled time for the same mark.
+	if l.lastRotationTime.Before(mark) {
+		if l.skipRotation() {
+			l.lastRotationTime = currentTime()
+		} else if err := l.rotate("time"); err != nil { // Scheduled rotations are "time" based for filename
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] scheduled rotation failed: %v\n", l.Filename, err)
+		} else {
+			l.lastRotationTime = currentTime() // Update lastRotationTime after successful scheduled rotation
+		}
+	}
+}
+
+// validPolicy returns value (lower-cased) if it is one of allowed, the first
+// allowed value (the default) if it is empty, and warns and returns the default otherwise.
+func validPolicy(field, value string, allowed ...string) string {
+	v := strings.ToLower(strings.TrimSpace(value))
+	if v == "" {
+		return allowed[0]
+	}
+	if slices.Contains(allowed, v) {
+		return v
+	}
+	fmt.Fprintf(os.Stderr, "timberjack: invalid %s %q — using %s\n", field, value, allowed[0])
+	return allowed[0]
+}
+
+// markOccurrences returns the instants at which the wall-clock mark occurs on the
+// calendar day of date in loc, sorted. Outside DST transitions that is exactly one
+// instant. A mark inside a spring-forward gap yields the end of the gap ("shift")
+// or nothing ("skip"); a mark inside a fall-back overlap yields its first, last
+// or both occurrences according to the overlap policy.
+func markOccurrences(date time.Time, m rotateAt, loc *time.Location, gapPolicy, overlapPolicy string) []time.Time {
+	year, month, day := date.In(loc).Date()
+	t := time.Date(year, month, day, m[0], m[1], 0, 0, loc)
+
+	if t.Hour() != m[0] || t.Minute() != m[1] || t.Day() != day {
+		// The wall-clock time does not exist: it falls into a gap.
+		if gapPolicy == dstSkip {
+			return nil
+		}
+		// time.Date normalized t to one side of the gap. The first instant after
+		// the gap is the transition, i.e. the start of t's zone period if t was
+		// pushed forward, or its end if t was pulled back.
+		start, end := t.ZoneBounds()
+		want := time.Date(year, month, day, m[0], m[1], 0, 0, time.UTC)
+		got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+		if got.After(want) {
+			return []time.Time{start}
+		}
+		return []time.Time{end}
+	}
+
+	// Look for the same wall-clock time in the neighbouring zone periods.
+	occurrences := []time.Time{t}
+	_, offset := t.Zone()
+	start, end := t.ZoneBounds()
+	if !start.IsZero() {
+		_, prevOffset := start.Add(-time.Nanosecond).Zone()
+		if alt := t.Add(time.Duration(offset-prevOffset) * time.Second); prevOffset != offset && alt.Before(start) {
+			occurrences = []time.Time{alt, t}
+		}
+	}
+	if !end.IsZero() {
+		_, nextOffset := end.Zone()
+		if alt := t.Add(time.Duration(offset-nextOffset) * time.Second); nextOffset != offset && !alt.Before(end) {
+			occurrences = append(occurrences, alt)
+		}
+	}
+
+	if len(occurrences) == 2 {
+		switch overlapPolicy {
+		case dstLast:
+			return occurrences[1:]
+		case dstBoth:
+			return occurrences
+		default: // dstFirst
+			return occurrences[:1]
+		}
+	}
+	return occurrences
+}
+
+// nextScheduledRotation returns the earliest occurrence of any of marks strictly
+// after now, evaluated on the wall clock of loc. The bool is false only if no
+// occurrence exists in the next few days (e.g. marks is empty).
+func nextScheduledRotation(now time.Time, marks []rotateAt, loc *time.Location, gapPolicy, overlapPolicy string) (time.Time, bool) {
+	local := now.In(loc)
+	// Start from yesterday in case a fall-back overlap around midnight repeats
+	// part of the previous calendar day.
+	for dayOffset := -1; dayOffset <= 2; dayOffset++ {
+		date := time.Date(local.Year(), local.Month(), local.Day()+dayOffset, 12, 0, 0, 0, loc)
+		var next time.Time
+		for _, m := range marks {
+			for _, occ := range markOccurrences(date, m, loc, gapPolicy, overlapPolicy) {
+				if occ.After(now) && (next.IsZero() || occ.Before(next)) {
+					next = occ
+				}
+			}
+		}
+		if !next.IsZero() {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dueScheduledMark returns the first of today's marks (in the order of marks) that
+// has been crossed since last, i.e. last < mark <= now.
+func dueScheduledMark(last, now time.Time, marks []rotateAt, loc *time.Location, gapPolicy, overlapPolicy string) (time.Time, bool) {
+	for _, m := range marks {
+		for _, mark := range markOccurrences(now, m, loc, gapPolicy, overlapPolicy) {
+			if last.Before(mark) && !mark.After(now) {
+				return mark, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Close implements io.Closer, and closes the current logfile.
+// It also signals any running goroutines (like scheduled rotation or mill) to stop.
+// It doesn't wait for compression or cleanup in progress; use Shutdown for that.
+func (l *Logger) Close() error {
+	closed, err := l.close(false)
+	if closed && l.RotateOnClose {
+		// force a rotate to happen at the end of close
+		if err1 := l.millRunOnce(); err1 != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to mill: %v",
+				l.Filename, err1)
+			if err == nil {
+				err = err1
+			}
+		}
+	}
+	return err
+}
+
+// ShutdownError is returned by Shutdown when its context expires before
+// compression and cleanup of backups have finished.
+type ShutdownError struct {
+	Err     error    // the context's error, joined with any error closing the file
+	Pending []string // backups that were not compressed or encrypted yet
+}
+
+func (e *ShutdownError) Error() string {
+	if len(e.Pending) == 0 {
+		return fmt.Sprintf("timberjack: shutdown incomplete: %v", e.Err)
+	}
+	return fmt.Sprintf("timberjack: shutdown incomplete, %d backups left unarchived: %v", len(e.Pending), e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error { return e.Err }
+
+// Shutdown closes the Logger like Close, but also syncs the log file
+// regardless of SyncPolicy, and waits for the compression and cleanup of
+// backups in progress (including the final pass of RotateOnClose) until ctx is
+// done. If ctx expires first, Shutdown returns a *ShutdownError listing the
+// backups that are still unarchived, and the remaining work stops after the
+// file being compressed. Interrupted compressions are cleaned up by the next
+// Logger for the same file.
+func (l *Logger) Shutdown(ctx context.Context) error {
+	err := l.beginShutdown()
+	if werr := waitContext(ctx, l.millWg.Wait); werr != nil {
+		return &ShutdownError{Err: errors.Join(werr, err), Pending: l.abandonMill()}
+	}
+	return err
+}
+
+// beginShutdown closes the Logger for Shutdown and starts the final mill pass
+// of RotateOnClose.
+func (l *Logger) beginShutdown() error {
+	closed, err := l.close(true)
+	if closed && l.RotateOnClose {
+		if l.manager != nil {
+			l.manager.enqueueMill(l)
+		} else {
+			l.millWg.Add(1)
+			go func() {
+				defer l.millWg.Done()
+				if err := l.millRunOnce(); err != nil {
+					fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to mill: %v\n", l.Filename, err)
+				}
+			}()
+		}
+	}
+	return err
+}
+
+// abandonMill stops compressing backups after the file in progress and returns
+// the backups that are still unarchived.
+func (l *Logger) abandonMill() []string {
+	atomic.StoreUint32(&l.millStopped, 1)
+	if l.archiveSuffix() == "" {
+		return nil
+	}
+	var pending []string
+	files, _ := l.oldLogFiles()
+	for _, f := range files {
+		if !isArchived(f.Name()) {
+			pending = append(pending, f.path())
+		}
+	}
+	return pending
+}
+
+// waitContext calls wait and returns nil when it returns, or ctx's error if
+// ctx is done first.
+func waitContext(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close marks the Logger closed, stops the scheduled rotation and mill
+// goroutines (without waiting for the mill), and closes the file, rotating it
+// first with RotateOnClose. With forceSync, the file is synced before it's
+// closed regardless of SyncPolicy. It reports whether the Logger was open.
+func (l *Logger) close(forceSync bool) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if atomic.LoadUint32(&l.isClosed) == 1 {
+		return false, nil // Already closed
+	}
+
 	atomic.StoreUint32(&l.isClosed, 1)
+	if l.manager != nil {
+		l.manager.remove(l)
+	}
+
+	if forceSync || l.syncOnRotate() {
+		if err := l.syncFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to sync log file: %v\n", l.Filename, err)
+		}
+	}
 
 	// Stop and wait for the scheduled rotation goroutine
 	if l.scheduledRotationQuitCh != nil {
@@ -551,29 +1698,33 @@ func (l *Logger) Close() error {
 		l.millCh = nil
 	}
 
+	if l.idleTimer != nil {
+		l.idleTimer.Stop()
+	}
+	if l.syncTimer != nil {
+		l.syncTimer.Stop()
+	}
+	if l.closeCh != nil {
+		close(l.closeCh) // wake up blocked writes
+	}
+
+	if l.RotateOnClose {
+		l.writeFooter("closing")
+	}
 	err := l.closeFile() // Call the internal method to close the file descriptor
 
 	if l.RotateOnClose {
 		// create backup from the active log file
-		if err1 := l.openNew("closing"); err1 != nil {
+		if err1 := l.rotateOnClose(); err1 != nil {
 			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to create a backup: %v",
 				l.Filename, err1)
 			if err == nil {
 				err = err1
 			}
 		}
-
-		// force a rotate to happen at the end of close
-		if err1 := l.millRunOnce(); err1 != nil {
-			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to mill: %v",
-				l.Filename, err1)
-			if err == nil {
-				err = err1
-			}
-		}
 	}
 
-	return err
+	return true, err
 }
 
 // closeFile closes the file if it is open. This is an internal method.
@@ -599,6 +1750,12 @@ func (l *Logger) Rotate() error {
 // It expects l.mu to be held by the caller.
 // Takes an explicit reason for the rotation which is used in the backup filename.
 func (l *Logger) rotate(reason string) error {
+	l.writeFooter(reason)
+	if l.syncOnRotate() {
+		if err := l.syncFile(); err != nil {
+			return &fileError{fmt.Errorf("can't sync log file: %s", err)}
+		}
+	}
 	if err := l.closeFile(); err != nil {
 		return err
 	}
@@ -626,6 +1783,10 @@ func (l *Logger) RotateWithReason(reason string) error {
 		return errors.New("logger closed")
 	}
 
+	if l.skipRotation() {
+		return nil
+	}
+
 	r := sanitizeReason(reason)
 	if r == "" {
 		// keep legacy Rotate() semantics
@@ -638,76 +1799,380 @@ func (l *Logger) RotateWithReason(reason string) error {
 	return l.rotate(r)
 }
 
+// Reopen closes the log file and opens Filename again, creating it if it
+// doesn't exist, without rotating: nothing is renamed and no backup is made.
+// It's meant for tools like logrotate that move the file aside themselves and
+// then notify the process (see HandleSignals). The time of the last rotation
+// and the scheduled rotations are kept.
+func (l *Logger) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if atomic.LoadUint32(&l.isClosed) == 1 {
+		return errors.New("logger closed")
+	}
+
+	if l.syncOnRotate() {
+		if err := l.syncFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to sync log file: %v\n", l.Filename, err)
+		}
+	}
+	if err := l.closeFile(); err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to close log file: %v\n", l.Filename, err)
+	}
+
+	l.footerReason = "" // the file was replaced
+	l.logStartTime = time.Time{}
+
+	info, err := osStat(l.filename())
+	if os.IsNotExist(err) {
+		err = l.openNew("initial") // nothing to move aside
+	} else if err == nil {
+		err = l.openExisting(info)
+	}
+	if err != nil {
+		return fmt.Errorf("can't reopen log file: %w", err)
+	}
+	if l.lastRotationTime.IsZero() {
+		l.lastRotationTime = currentTime().In(l.location())
+	}
+	return nil
+}
+
 // openNew creates a new log file for writing.
-// If an old log file already exists, it is moved aside by renaming it with a timestamp.
+// If an old log file already exists, it is moved aside first (see moveAside).
 // This method assumes that l.mu is held and the old file (if any) has already been closed.
 // The reasonForBackup parameter is used in the backup filename.
 func (l *Logger) openNew(reasonForBackup string) error {
-	err := os.MkdirAll(l.dir(), 0755)
+	err := os.MkdirAll(l.dir(), l.dirMode())
 	if err != nil {
-		return fmt.Errorf("can't make directories for new logfile: %s", err)
+		return &fileError{fmt.Errorf("can't make directories for new logfile: %s", err)}
 	}
 
 	name := l.filename()
-	finalMode := os.FileMode(0640)
-	var oldInfo os.FileInfo
+	backup, oldInfo, err := l.moveAside(reasonForBackup)
+	if err != nil {
+		return err
+	}
 
-	info, err := osStat(name)
-	if err == nil {
-		oldInfo = info
-		finalMode = oldInfo.Mode()
-
-		rotationTimeForBackup := currentTime()
-
-		if !l.isBackupTimeFormatValidated {
-			// a backup format has been supplied.
-			validationErr := l.ValidateBackupTimeFormat()
-			if validationErr != nil {
-				// some validation issue.
-				// backup format is empty or invalid.
-				// use backupformat constant
-				l.BackupTimeFormat = backupTimeFormat
-				if !errors.Is(validationErr, ErrEmptyBackupTimeFormatField) {
-					fmt.Fprintf(os.Stderr,
-						"timberjack: invalid BackupTimeFormat: %v — falling back to default format: %s\n",
-						validationErr, backupTimeFormat)
-				}
-			}
-			// mark the backup format as validated if there was no error.
-			// this would prevent validation checks in every rotation
-			l.isBackupTimeFormatValidated = true
+	// Create and open the new log file at path `name`, or at the time-stamped
+	// path Filename links to.
+	path := name
+	if l.ActiveFileTimeFormat != "" {
+		path = l.newActiveFileName(l.logStartTime)
+		l.activePath.Store(path)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, l.fileMode(oldInfo))
+	if err != nil {
+		return &fileError{fmt.Errorf("can't open new logfile %s: %s", path, err)}
+	}
+	// Set the configured mode and ownership, or keep the old file's ownership.
+	l.setPermissions(path, l.FileMode, oldInfo)
+	l.file = f
+	l.size = 0
+	l.lines = 0
+	l.headerSize = 0
+	l.footerReason = ""
+	l.segmentHash, l.segmentHashed = nil, 0
+	if l.Manifest || l.HashChain {
+		l.segmentHash = sha256.New()
+	}
+
+	if l.Header != nil {
+		header := l.Header(SegmentInfo{Filename: path, Start: l.logStartTime, Reason: reasonForBackup, Previous: backup})
+		n, err := l.writeFile(header)
+		l.size += int64(n)
+		l.headerSize = int64(n)
+		if err != nil {
+			return &fileError{fmt.Errorf("can't write header to new logfile %s: %s", path, err)}
 		}
+	}
+
+	if l.ActiveFileTimeFormat != "" {
+		if err := l.linkActiveFile(path); err != nil {
+			return fmt.Errorf("can't link %s to new logfile %s: %s", name, path, err)
+		}
+	}
+	l.unsyncedBytes = 0
+	l.lastSyncTime = time.Time{}
+	l.syncDirIfNeeded(l.dir())
+	return nil
+}
+
+// moveAside moves the log file, if it exists, aside by renaming it with a
+// timestamp and reasonForBackup (in ActiveFileTimeFormat mode it keeps its
+// time-stamped name), and starts a new segment. It returns where the file
+// went ("" if nowhere) and its info (nil if it didn't exist).
+// It expects l.mu to be held and the file to be closed.
+func (l *Logger) moveAside(reasonForBackup string) (backup string, oldInfo os.FileInfo, err error) {
+	name := l.filename()
+	info, err := osStat(name)
+	if os.IsNotExist(err) {
+		l.logStartTime = currentTime()
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to stat log file %s: %w", name, err)
+	}
 
-		newname := backupName(name, l.LocalTime, reasonForBackup, rotationTimeForBackup, l.BackupTimeFormat, l.AppendTimeAfterExt)
+	rotationTimeForBackup := currentTime()
+	segmentStart := l.logStartTime
 
-		if errRename := osRename(name, newname); errRename != nil {
-			return fmt.Errorf("can't rename log file: %s", errRename)
+	if l.ActiveFileTimeFormat != "" && isSymlink(name) {
+		// The live file is a time-stamped segment behind the symlink:
+		// it is finalized under its own name instead of being renamed.
+		if backup, err = l.finalizeActiveFile(rotationTimeForBackup); err != nil {
+			return "", nil, err
 		}
 		l.logStartTime = rotationTimeForBackup
-	} else if os.IsNotExist(err) {
-		l.logStartTime = currentTime()
-		oldInfo = nil
-	} else {
-		return fmt.Errorf("failed to stat log file %s: %w", name, err)
+	} else if backup, err = l.backupCurrentFile(reasonForBackup, rotationTimeForBackup); err != nil {
+		return "", nil, err
 	}
+	if backup != "" {
+		l.recordRotation(backup, reasonForBackup, segmentStart, rotationTimeForBackup)
+	}
+	return backup, info, nil
+}
+
+// rotateOnClose moves the log file aside with reason "closing" for
+// RotateOnClose. Unlike rotate, it doesn't create a new file, since nothing
+// will be written to it. It expects l.mu to be held and the file to be closed.
+func (l *Logger) rotateOnClose() error {
+	if _, _, err := l.moveAside("closing"); err != nil {
+		return err
+	}
+	if l.ActiveFileTimeFormat != "" && isSymlink(l.filename()) {
+		// Filename links to the finalized segment; the next Logger would
+		// append to it.
+		if err := os.Remove(l.filename()); err != nil {
+			return fmt.Errorf("can't remove link %s: %s", l.filename(), err)
+		}
+		l.activePath.Store("")
+	}
+	l.syncDirIfNeeded(l.dir())
+	return nil
+}
+
+// fileMode returns the mode to create a log file with, replacing the file
+// described by old (which may be nil).
+func (l *Logger) fileMode(old os.FileInfo) os.FileMode {
+	switch {
+	case l.FileMode != 0:
+		return l.FileMode
+	case old != nil:
+		return old.Mode()
+	default:
+		return 0640
+	}
+}
+
+// dirMode returns the mode to create directories with.
+func (l *Logger) dirMode() os.FileMode {
+	if l.DirMode != 0 {
+		return l.DirMode
+	}
+	return 0755
+}
 
-	// Create and open the new log file at path `name`.
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, finalMode)
+// ownership returns the uid and gid from Owner and Group, -1 for each that is
+// unset or can't be resolved.
+func (l *Logger) ownership() (uid, gid int) {
+	l.ownershipOnce.Do(func() {
+		var err error
+		if l.uid, err = lookupID(l.Owner, lookupUser); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] invalid Owner %q: %v\n", l.Filename, l.Owner, err)
+		}
+		if l.gid, err = lookupID(l.Group, lookupGroup); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] invalid Group %q: %v\n", l.Filename, l.Group, err)
+		}
+	})
+	return l.uid, l.gid
+}
+
+// lookupID resolves a numeric ID or a name with lookup. It returns -1 for "".
+func lookupID(s string, lookup func(string) (int, error)) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(s); err == nil {
+		return id, nil
+	}
+	id, err := lookup(s)
 	if err != nil {
-		return fmt.Errorf("can't open new logfile %s: %s", name, err)
+		return -1, err
+	}
+	return id, nil
+}
+
+// lookupUser returns the uid of the named user.
+func lookupUser(name string) (int, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGroup returns the gid of the named group.
+func lookupGroup(name string) (int, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// setPermissions applies mode (if non-zero) and the configured Owner and Group
+// to a file the Logger created. Without Owner and Group, the ownership of
+// old (if non-nil) is copied instead. Failures are reported on stderr.
+func (l *Logger) setPermissions(name string, mode os.FileMode, old os.FileInfo) {
+	if mode != 0 {
+		if err := os.Chmod(name, mode); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to chmod %s: %v\n", l.Filename, name, err)
+		}
+	}
+	var err error
+	if uid, gid := l.ownership(); uid != -1 || gid != -1 {
+		err = chownIDs(name, uid, gid)
+	} else if old != nil {
+		err = chown(name, old)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to chown %s: %v\n", l.Filename, name, err)
+	}
+}
+
+// backupCurrentFile moves the current log file aside to its backup name, which
+// it returns. It expects l.mu to be held and the file to be closed.
+func (l *Logger) backupCurrentFile(reasonForBackup string, rotationTimeForBackup time.Time) (string, error) {
+	name := l.filename()
+
+	if !l.isBackupTimeFormatValidated {
+		// a backup format has been supplied.
+		validationErr := l.ValidateBackupTimeFormat()
+		if validationErr != nil {
+			// some validation issue.
+			// backup format is empty or invalid.
+			// use backupformat constant
+			l.BackupTimeFormat = backupTimeFormat
+			if !errors.Is(validationErr, ErrEmptyBackupTimeFormatField) {
+				fmt.Fprintf(os.Stderr,
+					"timberjack: invalid BackupTimeFormat: %v — falling back to default format: %s\n",
+					validationErr, backupTimeFormat)
+			}
+		}
+		// mark the backup format as validated if there was no error.
+		// this would prevent validation checks in every rotation
+		l.isBackupTimeFormatValidated = true
 	}
-	l.file = f
-	l.size = 0
 
-	// Now that the new file `name` is created, if there was an old file, try to chown the new one.
-	if oldInfo != nil {
-		if errChown := chown(name, oldInfo); errChown != nil {
-			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to chown new log file %s: %v\n", l.Filename, name, errChown)
+	backupDir := l.backupDirFor(rotationTimeForBackup)
+	if l.BackupDir != "" {
+		if err := os.MkdirAll(backupDir, l.dirMode()); err != nil {
+			return "", fmt.Errorf("can't make backup directory: %s", err)
+		}
+	}
+	newname := l.newBackupName(backupDir, reasonForBackup, rotationTimeForBackup)
+
+	if errRename := osRename(name, newname); errRename != nil {
+		return "", fmt.Errorf("can't rename log file: %s", errRename)
+	}
+	if backupDir != l.dir() {
+		l.syncDirIfNeeded(backupDir)
+	}
+	l.logStartTime = rotationTimeForBackup
+	return newname, nil
+}
+
+// finalizeActiveFile completes the segment Filename links to in
+// ActiveFileTimeFormat mode, moving it into BackupDir if one is configured.
+// It returns the segment's final path, or "" if there is no segment.
+// It expects l.mu to be held and the file to be closed.
+func (l *Logger) finalizeActiveFile(t time.Time) (string, error) {
+	current := l.activeFilePath()
+	if current == "" {
+		return "", nil
+	}
+	if _, err := os.Lstat(current); os.IsNotExist(err) {
+		return "", nil // dangling link, nothing to finalize
+	}
+	if l.BackupDir == "" {
+		return current, nil // finalized in place
+	}
+	backupDir := l.backupDirFor(t)
+	if err := os.MkdirAll(backupDir, l.dirMode()); err != nil {
+		return "", fmt.Errorf("can't make backup directory: %s", err)
+	}
+	dest := filepath.Join(backupDir, filepath.Base(current))
+	if backupExists(dest) {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] %s already exists, leaving %s in place\n", l.Filename, dest, current)
+		return current, nil
+	}
+	if err := osRename(current, dest); err != nil {
+		return "", fmt.Errorf("can't move log file to backup directory: %s", err)
+	}
+	l.syncDirIfNeeded(backupDir)
+	return dest, nil
+}
+
+// newActiveFileName returns an unused time-stamped path for a segment started
+// at t in ActiveFileTimeFormat mode.
+func (l *Logger) newActiveFileName(t time.Time) string {
+	prefix, ext := l.prefixAndExt()
+	stamp := t.In(l.location()).Format(l.ActiveFileTimeFormat)
+	for n := 0; ; n++ {
+		s := stamp
+		if n > 0 {
+			s += "-" + strconv.Itoa(n)
+		}
+		name := prefix + s + ext // <name>-<stamp><ext>
+		if l.AppendTimeAfterExt {
+			name = prefix[:len(prefix)-1] + ext + "-" + s // <name><ext>-<stamp>
 		}
+		if !backupExists(filepath.Join(l.dir(), name)) && !backupExists(filepath.Join(l.backupDirFor(t), name)) {
+			return filepath.Join(l.dir(), name)
+		}
+	}
+}
+
+// linkActiveFile atomically points the Filename symlink at path by renaming a
+// freshly created link over it.
+func (l *Logger) linkActiveFile(path string) error {
+	name := l.filename()
+	tmp := filepath.Join(l.dir(), "."+filepath.Base(name)+".link")
+	_ = os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(path), tmp); err != nil {
+		return err
+	}
+	if err := osRename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return err
 	}
 	return nil
 }
 
+// activeFilePath returns the path of the live time-stamped file in
+// ActiveFileTimeFormat mode, or "" if it is unknown.
+func (l *Logger) activeFilePath() string {
+	if p, ok := l.activePath.Load().(string); ok && p != "" {
+		return p
+	}
+	target, err := os.Readlink(l.filename())
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(l.dir(), target)
+	}
+	return target
+}
+
+// isSymlink reports whether name is a symbolic link.
+func isSymlink(name string) bool {
+	info, err := os.Lstat(name)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
 // shouldTimeRotate checks if the time-based rotation interval has elapsed
 // since the last rotation. This is used for RotationInterval logic.
 func (l *Logger) shouldTimeRotate() bool {
@@ -724,20 +2189,16 @@ func (l *Logger) shouldTimeRotate() bool {
 
 // backupName creates a new backup filename by inserting a timestamp and a rotation reason
 // ("time" or "size") between the filename prefix and the extension.
-// It uses the local time if requested (otherwise UTC).
-func backupName(name string, local bool, reason string, t time.Time, fileTimeFormat string, appendTimeAfterExt bool) string {
+// The timestamp is formatted in loc.
+func backupName(name string, loc *time.Location, reason string, t time.Time, fileTimeFormat string, appendTimeAfterExt bool) string {
 
 	dir := filepath.Dir(name)
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
 	prefix := filename[:len(filename)-len(ext)]
 
-	currentLoc := time.UTC
-	if local {
-		currentLoc = time.Local
-	}
 	// Format the timestamp for the backup file.
-	timestamp := t.In(currentLoc).Format(fileTimeFormat)
+	timestamp := t.In(loc).Format(fileTimeFormat)
 
 	if appendTimeAfterExt {
 		// <name><ext>-<ts>-<reason>
@@ -749,44 +2210,120 @@ func backupName(name string, local bool, reason string, t time.Time, fileTimeFor
 	return filepath.Join(dir, fmt.Sprintf("%s-%s-%s%s", prefix, timestamp, reason, ext))
 }
 
-// openExistingOrNew opens the existing logfile if it exists and the current write
-// would not cause it to exceed MaxSize. If the file does not exist, or if writing
-// would exceed MaxSize, the current file is rotated (if it exists) and a new logfile is created.
-// It expects l.mu to be held by the caller.
-func (l *Logger) openExistingOrNew(writeLen int) error {
-	l.mill() // Perform house-keeping for old logs (compression, deletion) first.
+// newBackupName returns the path in dir the current log file is renamed to when
+// rotated at t for the given reason. With BackupSequence, the next sequence number
+// is appended to the reason, skipping any name that is already taken.
+func (l *Logger) newBackupName(dir, reason string, t time.Time) string {
+	name := l.filename()
+	if !l.BackupSequence {
+		return filepath.Join(dir, filepath.Base(backupName(name, l.location(), reason, t, l.BackupTimeFormat, l.AppendTimeAfterExt)))
+	}
 
-	filename := l.filename()
-	info, err := osStat(filename)
-	if os.IsNotExist(err) {
-		// File doesn't exist, so openNew is creating a new file.
-		// The 'reason' passed to openNew here ("initial") won't affect a backup filename
-		// as no backup (renaming) is happening.
+	if !l.backupSeqLoaded {
+		// Continue from the highest sequence left by previous runs.
+		if files, err := l.oldLogFiles(); err == nil {
+			for _, f := range files {
+				l.backupSeq = max(l.backupSeq, f.seq)
+			}
+		}
+		l.backupSeqLoaded = true
+	}
+
+	for {
+		l.backupSeq++
+		seqReason := reason + "-" + strconv.Itoa(l.backupSeq)
+		newname := filepath.Join(dir, filepath.Base(backupName(name, l.location(), seqReason, t, l.BackupTimeFormat, l.AppendTimeAfterExt)))
+		if !backupExists(newname) {
+			return newname
+		}
+	}
+}
+
+// backupExists reports whether name, or a compressed or encrypted version of it, exists.
+func backupExists(name string) bool {
+	for _, suffix := range append([]string{""}, archiveSuffixes...) {
+		if _, err := os.Lstat(name + suffix); !os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// openExistingOrNew opens the existing logfile if it exists and the current write
+// would not cause it to exceed MaxSize. If the file does not exist, or if writing
+// would exceed MaxSize, the current file is rotated (if it exists) and a new logfile is created.
+// It expects l.mu to be held by the caller.
+func (l *Logger) openExistingOrNew(writeLen int) error {
+	l.mill() // Perform house-keeping for old logs (compression, deletion) first.
+
+	filename := l.filename()
+	info, err := osStat(filename)
+	if os.IsNotExist(err) {
+		// File doesn't exist, so openNew is creating a new file.
+		// The 'reason' passed to openNew here ("initial") won't affect a backup filename
+		// as no backup (renaming) is happening.
 		return l.openNew("initial")
 	}
 	if err != nil {
-		return fmt.Errorf("error getting log file info: %s", err)
+		return &fileError{fmt.Errorf("error getting log file info: %s", err)}
 	}
 
-	// Check if rotation is needed due to size before opening/appending.
-	if info.Size()+int64(writeLen) >= l.max() {
+	// Check if rotation is needed due to size before opening/appending. With
+	// MinRotationInterval, the file is opened anyway and rotated like any open
+	// file once it's old enough.
+	if info.Size()+int64(writeLen) >= l.max() && l.MinRotationInterval <= 0 {
 		return l.rotate("size") // This rotation is explicitly due to "size"
 	}
 
 	// Open existing file for appending.
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644) // Mode 0644 is common for append.
-	if err != nil {
+	if err := l.openExisting(info); err != nil {
 		// If opening existing fails (e.g., permissions, corruption), try to create a new one.
 		return l.openNew("initial") // Fallback if append fails
 	}
-	l.file = file
-	l.size = info.Size()
 	// Note: l.logStartTime is NOT updated here if we successfully open an existing file without rotating.
 	// It retains its value from when this current log segment was created (by a previous openNew).
 	// l.lastRotationTime is also NOT updated here; it's handled by rotation trigger logic.
 	return nil
 }
 
+// openExisting opens the existing log file, described by info, for appending.
+// It expects l.mu to be held and the old file (if any) to be closed.
+func (l *Logger) openExisting(info os.FileInfo) error {
+	filename := l.filename()
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644) // Mode 0644 is common for append.
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	l.lines = 0
+	l.headerSize = 0
+	if l.MaxLines > 0 {
+		// Header and Footer lines can't be told apart here, so they count.
+		if l.lines, err = countLines(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to count lines of log file: %v\n", l.Filename, err)
+		}
+	}
+	l.segmentHash, l.segmentHashed = nil, 0 // unknown content, hashed on rotation
+	if l.ActiveFileTimeFormat != "" && isSymlink(filename) {
+		l.activePath.Store("")
+		if active := l.activeFilePath(); active != "" {
+			l.activePath.Store(active)
+			if l.logStartTime.IsZero() {
+				prefix, ext := l.prefixAndExt()
+				if t, _, err := l.parseSegmentName(filepath.Base(active), prefix, ext); err == nil {
+					l.logStartTime = t
+				}
+			}
+		}
+	}
+	l.startEstimate = time.Time{}
+	if l.logStartTime.IsZero() && l.MinRotationInterval > 0 {
+		l.startEstimate = l.estimateStart(info)
+	}
+	return nil
+}
+
 // filename returns the current log filename, using the configured Filename,
 // or a default based on the process name if Filename is empty.
 func (l *Logger) filename() string {
@@ -801,7 +2338,13 @@ func (l *Logger) filename() string {
 // If compression is enabled, uncompressed backups are compressed using gzip.
 // Old backup files are deleted to enforce MaxBackups and MaxAge limits.
 func (l *Logger) millRunOnce() error {
-	if l.MaxBackups == 0 && l.MaxAge == 0 && l.effectiveCompression() == "none" {
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
+
+	l.recoverOnce.Do(l.recoverCompression) // clean up after a crash in a previous run
+	l.recordPendingRotations()
+
+	if l.MaxBackups == 0 && l.MaxAge == 0 && l.archiveSuffix() == "" {
 		return nil // Nothing to do if all cleanup options are disabled.
 	}
 
@@ -809,339 +2352,1113 @@ func (l *Logger) millRunOnce() error {
 	if err != nil {
 		return err
 	}
+	plan := l.planMill(files)
+
+	// files for callback
+	backupDir := l.backupDir()
+	filesForCallback := make([]string, 0, len(plan.keep)+len(plan.compress))
+	for _, f := range plan.keep {
+		filesForCallback = append(filesForCallback, f.relName(backupDir))
+	}
+	suffix := l.archiveSuffix()
+
+	// Execute removals
+	touchedDirs := make(map[string]bool) // directories to sync afterwards
+	for _, f := range plan.remove {
+		errRemove := osRemove(f.path())
+		if errRemove != nil && !os.IsNotExist(errRemove) { // Log error if removal failed and file wasn't already gone
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to remove old log file %s: %v\n", l.Filename, f.Name(), errRemove)
+		} else {
+			l.recordRemoval(f.path())
+		}
+		l.removeEmptyBackupDirs(f.dir)
+		touchedDirs[f.dir] = true
+	}
+
+	// Execute compressions
+	opts := archiveOptions{verify: l.VerifyCompression, keys: l.KeyProvider, mode: l.ArchiveMode}
+	if len(plan.compress) > 0 {
+		opts.uid, opts.gid = l.ownership()
+	}
+	var segments map[string]ManifestEntry // for the "compress" entries of the manifest
+	if l.Manifest && len(plan.compress) > 0 {
+		segments = l.manifestSegments()
+	}
+	for _, f := range plan.compress {
+		if atomic.LoadUint32(&l.millStopped) == 1 {
+			break // Shutdown timed out
+		}
+		fn := f.path()
+		fileForCB := f.relName(backupDir)
+		if errCompress := archiveLogFile(fn, fn+suffix, opts); errCompress != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to compress log file %s: %v\n", l.Filename, f.Name(), errCompress)
+		} else {
+			fileForCB += suffix
+			l.recordCompression(fn, fn+suffix, segments)
+		}
+		filesForCallback = append(filesForCallback, fileForCB)
+		touchedDirs[f.dir] = true
+	}
+
+	for dir := range touchedDirs {
+		if _, err := os.Stat(dir); err == nil { // may have been removed as empty
+			l.syncDirIfNeeded(dir)
+		}
+	}
+
+	if l.Callback != nil && len(filesForCallback) != 0 {
+		l.Callback(backupDir, filesForCallback)
+	}
+
+	return nil
+}
+
+// RetentionPlan is what the mill does with the backups of a Logger, as
+// returned by PlanRetention. Every backup is in exactly one of the lists,
+// newest first.
+type RetentionPlan struct {
+	Keep     []string          // backups left as they are
+	Delete   []RetentionDelete // backups removed
+	Compress []string          // backups compressed (or encrypted), then kept
+}
+
+// RetentionDelete is a backup removed by the mill, and the rule responsible.
+type RetentionDelete struct {
+	Path string
+	Rule RetentionRule
+}
+
+// RetentionRule is a setting that makes the mill remove backups.
+type RetentionRule string
+
+// Values of RetentionRule.
+const (
+	RuleDeleteZeroSizeLog RetentionRule = "DeleteZeroSizeLog"
+	RuleMaxBackups        RetentionRule = "MaxBackups"
+	RuleMaxAge            RetentionRule = "MaxAge"
+)
+
+// PlanRetention returns what the mill would do with the backups now, without
+// doing it, e.g. to preview the effect of MaxBackups and MaxAge. The mill
+// runs the same plan after every rotation.
+//
+// The plan doesn't include the crash recovery that the first mill pass of a
+// Logger does before planning: leftover temporary archives aren't listed, and
+// a backup that a crash left both compressed and uncompressed appears twice
+// until recovery keeps one copy.
+func (l *Logger) PlanRetention() (RetentionPlan, error) {
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return RetentionPlan{}, err
+	}
+	p := l.planMill(files)
+	var plan RetentionPlan
+	for _, f := range p.keep {
+		plan.Keep = append(plan.Keep, f.path())
+	}
+	for _, r := range p.remove {
+		plan.Delete = append(plan.Delete, RetentionDelete{Path: r.path(), Rule: r.rule})
+	}
+	for _, f := range p.compress {
+		plan.Compress = append(plan.Compress, f.path())
+	}
+	return plan, nil
+}
+
+// millPlan is the work of a mill pass: a RetentionPlan of logInfos.
+type millPlan struct {
+	keep, compress []logInfo
+	remove         []plannedRemoval
+}
+
+// plannedRemoval is a backup to remove, and the rule responsible.
+type plannedRemoval struct {
+	logInfo
+	rule RetentionRule
+}
+
+// planMill decides what the mill does with backups, sorted newest first: the
+// ones it removes under DeleteZeroSizeLog, MaxBackups and MaxAge, the ones it
+// compresses, and the ones it leaves alone.
+func (l *Logger) planMill(files []logInfo) millPlan {
+	var p millPlan
+	if l.MaxBackups == 0 && l.MaxAge == 0 && l.archiveSuffix() == "" {
+		p.keep = files // The mill doesn't run.
+		return p
+	}
+
+	// A rotation event is identified by its timestamp and, with BackupSequence,
+	// its sequence number: MaxBackups keeps the files of the newest ones.
+	keys := make(map[rotationKey]bool)
+	cutoff := currentTime().Add(-time.Duration(int64(24*time.Hour) * int64(l.MaxAge)))
+	suffix := l.archiveSuffix()
+	for _, f := range files { // files is sorted newest first
+		// Zero size files are removed first, so that they don't count
+		// towards MaxBackups and get older files with content removed.
+		zero := l.DeleteZeroSizeLog && f.Size() == 0
+		if !zero && !keys[f.key()] && len(keys) < l.MaxBackups {
+			keys[f.key()] = true
+		}
+		switch {
+		case zero:
+			p.remove = append(p.remove, plannedRemoval{f, RuleDeleteZeroSizeLog})
+		case l.MaxBackups > 0 && !keys[f.key()]:
+			p.remove = append(p.remove, plannedRemoval{f, RuleMaxBackups})
+		case l.MaxAge > 0 && f.timestamp.Before(cutoff):
+			p.remove = append(p.remove, plannedRemoval{f, RuleMaxAge})
+		case suffix == "" || isArchived(f.Name()):
+			p.keep = append(p.keep, f)
+		default:
+			p.compress = append(p.compress, f)
+		}
+	}
+	return p
+}
+
+// millRun runs in a goroutine to manage post-rotation compression and removal
+// of old log files. It listens on millCh for signals to run millRunOnce.
+func (l *Logger) millRun(millCh <-chan bool) {
+	defer l.millWg.Done()
+	for range millCh { // Loop terminates when millCh is closed
+		_ = l.millRunOnce()
+	}
+}
+
+// mill performs post-rotation compression and removal of stale log files,
+// starting the mill goroutine if necessary and sending a signal to it.
+func (l *Logger) mill() {
+	if atomic.LoadUint32(&l.isClosed) == 1 {
+		return // Don't run if logger is closed
+	}
+	if l.manager != nil {
+		l.manager.enqueueMill(l)
+		return
+	}
+	l.startMill.Do(func() {
+		l.millCh = make(chan bool, 1) // Buffered channel of 1
+		l.millWg.Add(1)
+		go l.millRun(l.millCh)
+	})
+	select {
+	case l.millCh <- true: // Send signal to run millRunOnce
+	default: // Don't block if channel is full (mill is already busy)
+	}
+}
 
-	// cleanup all the zero size log files, this is to prevent a newer zero size file to close an older
-	// non-zero size file to be deleted due to constraints on # of backup
-	filesToProcess := make([]logInfo, 0, len(files))
+// BackupInfo describes a backup of the log file, as returned by Backups.
+type BackupInfo struct {
+	Path        string    // full path of the backup
+	Time        time.Time // rotation time from the name (start time for ActiveFileTimeFormat segments)
+	Reason      string    // why the file was rotated, e.g. "size"; "" for ActiveFileTimeFormat segments
+	Sequence    int       // sequence number from the name (BackupSequence), or 0
+	Compression string    // "none" | "gzip" | "zstd"
+	Encrypted   bool      // encrypted with KeyProvider
+	Size        int64     // size of the file in bytes
+
+	// PendingCompression is set if the mill will compress (or encrypt) the
+	// backup, and PendingDeletion if it will remove it under MaxBackups,
+	// MaxAge or DeleteZeroSizeLog, both as configured now.
+	PendingCompression bool
+	PendingDeletion    bool
+}
+
+// Backups returns the backups of the log file, newest first.
+func (l *Logger) Backups() ([]BackupInfo, error) {
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	plan := l.planMill(files)
+	removed := make(map[string]bool, len(plan.remove))
+	for _, r := range plan.remove {
+		removed[r.path()] = true
+	}
+	compressed := make(map[string]bool, len(plan.compress))
+	for _, f := range plan.compress {
+		compressed[f.path()] = true
+	}
+
+	backups := make([]BackupInfo, 0, len(files))
 	for _, f := range files {
-		if l.DeleteZeroSizeLog && f.FileInfo.Size() == 0 {
-			errRemove := osRemove(filepath.Join(l.dir(), f.Name()))
-			if errRemove != nil && !os.IsNotExist(errRemove) { // Log error if removal failed and file wasn't already gone
-				fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to remove old log file %s: %v\n", l.Filename, f.Name(), errRemove)
-			}
-			continue
+		alg, encrypted := archiveFormat(f.Name())
+		backups = append(backups, BackupInfo{
+			Path:               f.path(),
+			Time:               f.timestamp,
+			Reason:             f.reason,
+			Sequence:           f.seq,
+			Compression:        alg,
+			Encrypted:          encrypted,
+			Size:               f.Size(),
+			PendingCompression: compressed[f.path()],
+			PendingDeletion:    removed[f.path()],
+		})
+	}
+	return backups, nil
+}
+
+// oldLogFiles returns the list of backup log files, sorted by their embedded
+// timestamp (newest first). Backups are looked up in the same directory as the
+// current log file, or recursively under BackupDir if one is configured.
+func (l *Logger) oldLogFiles() ([]logInfo, error) {
+	var logFiles []logInfo
+
+	prefix, ext := l.prefixAndExt() // Get prefix like "filename-" and original extension like ".log"
+
+	err := l.walkBackupFiles(func(dir string, e fs.DirEntry) {
+		info, errInfo := e.Info() // Get FileInfo for modification time and other details
+		if errInfo != nil {
+			return // Skip files we can't stat
+		}
+		if t, seq, reason, errTime := l.parseBackupFile(e.Name(), prefix, ext); errTime == nil {
+			logFiles = append(logFiles, logInfo{timestamp: t, FileInfo: info, dir: dir, seq: seq, reason: reason})
 		}
-		filesToProcess = append(filesToProcess, f)
+		// Files that don't match the expected backup pattern are ignored.
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	filesToRemove := make([]logInfo, 0, len(filesToProcess)) // Accumulates files to be deleted
+	if l.ActiveFileTimeFormat != "" {
+		// Never treat the live segment as a backup. This is looked up after the
+		// listing, so a segment created concurrently is already known here.
+		if active := l.activeFilePath(); active != "" {
+			logFiles = slices.DeleteFunc(logFiles, func(f logInfo) bool {
+				return f.path() == active
+			})
+		}
+	}
 
-	// MaxBackups filtering: Keep files belonging to the MaxBackups newest distinct timestamps
-	if l.MaxBackups > 0 {
-		uniqueTimestamps := make([]time.Time, 0)
-		timestampMap := make(map[time.Time]bool)
-		for _, f := range filesToProcess { // filesToProcess is sorted newest first
-			if !timestampMap[f.timestamp] {
-				timestampMap[f.timestamp] = true
-				uniqueTimestamps = append(uniqueTimestamps, f.timestamp)
+	sort.Sort(byFormatTime(logFiles)) // Sorts newest first based on parsed timestamp
+	return logFiles, nil
+}
+
+// walkBackupFiles calls fn for every regular entry in the directory holding
+// backups: the directory of the current log file, or the whole BackupDir tree.
+func (l *Logger) walkBackupFiles(fn func(dir string, e fs.DirEntry)) error {
+	if l.BackupDir == "" {
+		dir := l.dir()
+		entries, err := os.ReadDir(dir) // ReadDir is generally preferred over ReadFile for directory listings
+		if err != nil {
+			return fmt.Errorf("can't read log file directory: %s", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() { // Skip directories
+				continue
 			}
+			fn(dir, e)
 		}
+		return nil
+	}
 
-		if len(uniqueTimestamps) > l.MaxBackups {
-			// Determine the set of timestamps to keep (the MaxBackups newest ones)
-			keptTimestampsSet := make(map[time.Time]bool)
-			for i := 0; i < l.MaxBackups; i++ {
-				keptTimestampsSet[uniqueTimestamps[i]] = true
+	// Walk the whole backup tree so date-partitioned subdirectories are found.
+	root := l.backupDir()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
 			}
+			return nil // Skip subtrees we can't read
+		}
+		if !d.IsDir() {
+			fn(filepath.Dir(path), d)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) { // BackupDir is created on the first rotation
+		return fmt.Errorf("can't read backup directory: %s", err)
+	}
+	return nil
+}
 
-			var filteredFiles []logInfo // Files that pass this MaxBackups filter
-			for _, f := range filesToProcess {
-				if keptTimestampsSet[f.timestamp] {
-					filteredFiles = append(filteredFiles, f)
-				} else {
-					filesToRemove = append(filesToRemove, f) // Mark for removal
-				}
-			}
-			filesToProcess = filteredFiles // Update filesToProcess for subsequent filters
-		}
-		// If len(uniqueTimestamps) <= l.MaxBackups, all files pass this MaxBackups filter.
-	}
-
-	// MaxAge filtering (operates on files that passed MaxBackups filter)
-	if l.MaxAge > 0 {
-		diff := time.Duration(int64(24*time.Hour) * int64(l.MaxAge))
-		cutoff := currentTime().Add(-1 * diff)
-		var filteredFiles []logInfo // Files that pass this MaxAge filter
-		for _, f := range filesToProcess {
-			if f.timestamp.Before(cutoff) {
-				// Check if already in filesToRemove to avoid duplicates
-				isAlreadyMarked := false
-				for _, rmf := range filesToRemove {
-					if rmf.Name() == f.Name() {
-						isAlreadyMarked = true
-						break
-					}
-				}
-				if !isAlreadyMarked {
-					filesToRemove = append(filesToRemove, f) // Mark for removal
-				}
-			} else {
-				filteredFiles = append(filteredFiles, f)
+// parseBackupFile parses the name of any kind of backup: a rotated file, a
+// finalized time-stamped segment, or a compressed version of either. The
+// reason is empty for segments.
+func (l *Logger) parseBackupFile(name, prefix, ext string) (time.Time, int, string, error) {
+	// e.g. "filename-timestamp-reason.log", then its .gz, .zst and .enc versions
+	for _, suffix := range append([]string{""}, archiveSuffixes...) {
+		if t, seq, reason, err := l.parseBackupName(name, prefix, ext+suffix); err == nil {
+			return t, seq, reason, nil
+		}
+	}
+	// Finalized time-stamped segments (ActiveFileTimeFormat), e.g. "filename-2025-05-01.log[.gz|.zst]"
+	if l.ActiveFileTimeFormat != "" {
+		for _, suffix := range append([]string{""}, archiveSuffixes...) {
+			if t, seq, err := l.parseSegmentName(name, prefix, ext+suffix); err == nil {
+				return t, seq, "", nil
 			}
 		}
-		filesToProcess = filteredFiles // Update filesToProcess for compression filter
 	}
+	return time.Time{}, 0, "", fmt.Errorf("not a backup file: %q", name)
+}
 
-	// files for callback
-	filesForCallback := make([]string, 0, len(filesToProcess))
+// timeFromName extracts the formatted timestamp from the backup filename.
+// It expects filenames like "prefix-YYYY-MM-DDTHH-MM-SS.mmm-reason.ext" or "prefix.ext-YYYY-MM-DDTHH-MM-SS.mmm-reason[.gz]"
+func (l *Logger) timeFromName(filename, prefix, ext string) (time.Time, error) {
+	t, _, _, err := l.parseBackupName(filename, prefix, ext)
+	return t, err
+}
+
+// parseBackupName is like timeFromName, but also returns the sequence number
+// of the backup when BackupSequence is enabled (0 otherwise), and the reason
+// of the rotation.
+func (l *Logger) parseBackupName(filename, prefix, ext string) (time.Time, int, string, error) {
+	if !l.AppendTimeAfterExt {
 
-	finalUniqueRemovals := make(map[string]logInfo)
-	for _, f := range filesToRemove {
-		finalUniqueRemovals[f.Name()] = f
+		// Keep legacy behavior for error messages to satisfy existing tests
+		if !strings.HasPrefix(filename, prefix) {
+			return time.Time{}, 0, "", errors.New("mismatched prefix")
+		}
+		if !strings.HasSuffix(filename, ext) {
+			return time.Time{}, 0, "", errors.New("mismatched extension")
+		}
+		// "<prefix><timestamp>-<reason><ext>"
+		trimmed := filename[len(prefix) : len(filename)-len(ext)]
+		if !strings.Contains(trimmed, "-") {
+			return time.Time{}, 0, "", fmt.Errorf("malformed backup filename: missing reason separator in %q", trimmed)
+		}
+		return l.parseStamp(trimmed)
 	}
 
-	toBeRemoved := func(name string) bool {
-		// Ensure this file isn't ALREADY marked for removal by a previous filter
-		// (e.g. MaxBackups removed it, but it also met MaxAge criteria before this loop)
-		// This check is somewhat redundant if filesToProcess is correctly filtered,
-		// but can be a safeguard. The main finalFilesToRemove handles uniques.
-		_, found := finalUniqueRemovals[name]
-		return found
+	// After-ext parsing:
+	// base is "<name><ext>" (e.g., "foo.log")
+	base := prefix[:len(prefix)-1] + ext
+
+	// Allow optional trailing compression suffix (".gz" or ".zst")
+	nameNoComp := trimCompressionSuffix(filename)
+
+	// nameNoComp must start with "<base>-"
+	if !strings.HasPrefix(nameNoComp, base+"-") {
+		return time.Time{}, 0, "", fmt.Errorf("malformed backup filename: %q", filename)
 	}
 
-	// Compression task identification (operates on files that passed MaxBackups and MaxAge)
-	var filesToCompress []logInfo
-	if l.effectiveCompression() == "none" {
-		// compression is disabled, identify files for callback
-		for _, f := range filesToProcess {
-			if !toBeRemoved(f.Name()) {
-				filesForCallback = append(filesForCallback, f.Name())
-			}
+	// nameNoComp = "<base>-<timestamp>-<reason>"
+	trimmed := nameNoComp[len(base)+1:]
+	if !strings.Contains(trimmed, "-") {
+		return time.Time{}, 0, "", fmt.Errorf("malformed backup filename: %q", filename)
+	}
+	return l.parseStamp(trimmed)
+}
+
+// parseSegmentName extracts the start time from the name of a time-stamped segment
+// written in ActiveFileTimeFormat mode: "prefix-<stamp>[-n].ext" or, with
+// AppendTimeAfterExt, "prefix.ext-<stamp>[-n][.gz|.zst]". The second value is the
+// collision suffix n, or 0.
+func (l *Logger) parseSegmentName(filename, prefix, ext string) (time.Time, int, error) {
+	var stamp string
+	if !l.AppendTimeAfterExt {
+		if !strings.HasPrefix(filename, prefix) || !strings.HasSuffix(filename, ext) || len(filename) < len(prefix)+len(ext) {
+			return time.Time{}, 0, fmt.Errorf("malformed segment filename: %q", filename)
 		}
+		stamp = filename[len(prefix) : len(filename)-len(ext)]
 	} else {
-		for _, f := range filesToProcess { // These are files that are meant to be kept (not in filesToRemove yet)
-			name := f.Name()
-			if strings.HasSuffix(name, compressSuffix) || strings.HasSuffix(name, zstdSuffix) {
-				filesForCallback = append(filesForCallback, f.Name())
-				continue // already compressed
+		base := prefix[:len(prefix)-1] + ext
+		nameNoComp := trimCompressionSuffix(filename)
+		if !strings.HasPrefix(nameNoComp, base+"-") {
+			return time.Time{}, 0, fmt.Errorf("malformed segment filename: %q", filename)
+		}
+		stamp = nameNoComp[len(base)+1:]
+	}
+
+	t, err := time.ParseInLocation(l.ActiveFileTimeFormat, stamp, l.location())
+	if err == nil {
+		return t, 0, nil
+	}
+	if idx := strings.LastIndex(stamp, "-"); idx != -1 {
+		if n, errN := strconv.Atoi(stamp[idx+1:]); errN == nil && n > 0 {
+			if t, errT := time.ParseInLocation(l.ActiveFileTimeFormat, stamp[:idx], l.location()); errT == nil {
+				return t, n, nil
 			}
-			if !toBeRemoved(name) {
-				filesToCompress = append(filesToCompress, f)
+		}
+	}
+	return time.Time{}, 0, err
+}
+
+// parseStamp parses "<timestamp>-<reason>", or "<timestamp>-<reason>-<seq>" when
+// BackupSequence is enabled, returning the timestamp, the sequence number and
+// the reason.
+func (l *Logger) parseStamp(s string) (time.Time, int, string, error) {
+	layout := l.BackupTimeFormat
+	if layout == "" {
+		layout = backupTimeFormat
+	}
+	loc := l.location()
+
+	lastHyphenIdx := strings.LastIndex(s, "-")
+	if l.BackupSequence {
+		// Only treat a numeric last segment as a sequence if what precedes it
+		// still parses, so purely numeric reasons keep working.
+		if seq, err := strconv.Atoi(s[lastHyphenIdx+1:]); err == nil && seq >= 0 {
+			rest := s[:lastHyphenIdx]
+			if idx := strings.LastIndex(rest, "-"); idx != -1 {
+				if t, err := time.ParseInLocation(layout, rest[:idx], loc); err == nil {
+					return t, seq, rest[idx+1:], nil
+				}
 			}
 		}
 	}
+	t, err := time.ParseInLocation(layout, s[:lastHyphenIdx], loc)
+	return t, 0, s[lastHyphenIdx+1:], err
+}
 
-	// Execute removals (ensure unique removals)
-	for _, f := range finalUniqueRemovals {
-		errRemove := osRemove(filepath.Join(l.dir(), f.Name()))
-		if errRemove != nil && !os.IsNotExist(errRemove) { // Log error if removal failed and file wasn't already gone
-			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to remove old log file %s: %v\n", l.Filename, f.Name(), errRemove)
+// max returns the maximum size in bytes of log files before rolling.
+func (l *Logger) max() int64 {
+	if l.MaxSize == 0 { // If MaxSize is 0, use default.
+		return int64(defaultMaxSize * megabyte)
+	}
+	return int64(l.MaxSize) * int64(megabyte)
+}
+
+// dir returns the directory for the current filename.
+func (l *Logger) dir() string {
+	return filepath.Dir(l.filename())
+}
+
+// backupDir returns the root directory that holds backups: BackupDir if set
+// (resolved against the log directory when relative), otherwise the log directory.
+func (l *Logger) backupDir() string {
+	if l.BackupDir == "" {
+		return l.dir()
+	}
+	if filepath.IsAbs(l.BackupDir) {
+		return filepath.Clean(l.BackupDir)
+	}
+	return filepath.Join(l.dir(), l.BackupDir)
+}
+
+// backupDirFor returns the directory a backup rotated at t is moved into,
+// applying the BackupDirTimeFormat partitioning if configured.
+func (l *Logger) backupDirFor(t time.Time) string {
+	root := l.backupDir()
+	if l.BackupDir == "" || l.BackupDirTimeFormat == "" {
+		return root
+	}
+	return filepath.Join(root, filepath.FromSlash(t.In(l.location()).Format(l.BackupDirTimeFormat)))
+}
+
+// removeEmptyBackupDirs removes dir and its parents, up to but excluding the
+// BackupDir root, for as long as they are empty. It is a no-op without BackupDir.
+func (l *Logger) removeEmptyBackupDirs(dir string) {
+	if l.BackupDir == "" {
+		return
+	}
+	root := l.backupDir()
+	for dir = filepath.Clean(dir); strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return // not empty (or already gone)
 		}
 	}
+}
 
-	// Execute compressions
-	suffix := l.compressedSuffix()
-	for _, f := range filesToCompress {
-		fn := filepath.Join(l.dir(), f.Name())
-		fileForCB := f.Name()
-		if errCompress := compressLogFile(fn, fn+suffix); errCompress != nil {
-			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to compress log file %s: %v\n", l.Filename, f.Name(), errCompress)
-		} else {
-			fileForCB = f.Name() + suffix
+// prefixAndExt returns the filename part (up to the extension, with a trailing dash for backups)
+// and extension part from the Logger's filename.
+// e.g., for "foo.log", returns "foo-", ".log"
+func (l *Logger) prefixAndExt() (prefix, ext string) {
+	filename := filepath.Base(l.filename())
+	ext = filepath.Ext(filename)
+	prefix = filename[:len(filename)-len(ext)] + "-" // Add dash as backup filenames include it after original prefix
+	return prefix, ext
+}
+
+// countDigitsAfterDot returns the number of consecutive digit characters
+// immediately following the first '.' in the input.
+// It skips all characters before the '.' and stops counting at the first non-digit
+// character after the '.'.
+
+// Example: `prefix.0012304123suffix` would return 10
+// Example: `prefix.0012304_middle_123_suffix` would return 7
+func countDigitsAfterDot(layout string) int {
+	for i, ch := range layout {
+		if ch == '.' {
+			count := 0
+			for _, c := range layout[i+1:] {
+				if unicode.IsDigit(c) {
+					count++
+				} else {
+					break
+				}
+			}
+			return count
 		}
-		filesForCallback = append(filesForCallback, fileForCB)
 	}
+	return 0 // no '.' found or no digits after dot
+}
 
-	if l.Callback != nil && len(filesForCallback) != 0 {
-		l.Callback(l.dir(), filesForCallback)
+// truncateFractional truncates time t to n fractional digits of seconds.
+// n=0 → truncate to seconds, n=3 → milliseconds, n=6 → microseconds, etc.
+func truncateFractional(t time.Time, n int) (time.Time, error) {
+	if n < 0 || n > 9 {
+		return time.Time{}, fmt.Errorf("unsupported fractional precision: %d", n)
 	}
 
-	return nil
+	// number of nanoseconds to keep
+	factor := math.Pow10(9 - n) // e.g. for n=3, factor=10^(9-3)=1,000,000
+
+	nanos := t.Nanosecond()
+	truncatedNanos := int((int64(nanos) / int64(factor)) * int64(factor))
+
+	return time.Date(
+		t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(),
+		truncatedNanos,
+		t.Location(),
+	), nil
 }
 
-// millRun runs in a goroutine to manage post-rotation compression and removal
-// of old log files. It listens on millCh for signals to run millRunOnce.
-func (l *Logger) millRun() {
-	for range l.millCh { // Loop terminates when millCh is closed
-		_ = l.millRunOnce()
+// VerifyError reports a backup that is corrupt, truncated, or doesn't match
+// the file it was compressed from or its manifest entry.
+type VerifyError struct {
+	Name string // path of the compressed backup
+	Err  error  // the decoding error, or one of the Err* values below
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("backup %s failed verification: %v", e.Name, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error { return e.Err }
+
+var (
+	// ErrChecksumMismatch is the VerifyError.Err of a backup whose content
+	// doesn't match its source or its manifest entry.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrSizeMismatch is the VerifyError.Err of a backup whose size doesn't
+	// match its manifest entry.
+	ErrSizeMismatch = errors.New("size mismatch")
+	// ErrBackupMissing is the VerifyError.Err of a backup that is listed in
+	// the manifest but doesn't exist.
+	ErrBackupMissing = errors.New("listed in the manifest but missing")
+	// ErrNotInManifest is the VerifyError.Err of a backup that exists but
+	// isn't listed in the manifest.
+	ErrNotInManifest = errors.New("not listed in the manifest")
+	// ErrChainBroken is wrapped by the VerifyError.Err of a hash chain link
+	// that doesn't follow its predecessor or doesn't match its digest.
+	ErrChainBroken = errors.New("hash chain broken")
+	// ErrBadSignature is wrapped by the VerifyError.Err of a hash chain link
+	// with a missing or invalid signature.
+	ErrBadSignature = errors.New("invalid signature")
+)
+
+// VerifyBackups checks the integrity of all compressed and encrypted backups
+// by fully decoding them, which verifies their checksums and trailers. It returns a
+// *VerifyError for every backup that fails; the error is non-nil only if the
+// backups can't be listed. Backups may be removed by the mill concurrently;
+// those are skipped.
+func (l *Logger) VerifyBackups() ([]*VerifyError, error) {
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return nil, err
 	}
+	var failed []*VerifyError
+	for _, f := range files {
+		name := f.path()
+		if !isArchived(name) {
+			continue
+		}
+		if err := validateArchive(name, l.KeyProvider); err != nil && !os.IsNotExist(err) {
+			failed = append(failed, &VerifyError{Name: name, Err: err})
+		}
+	}
+	return failed, nil
 }
 
-// mill performs post-rotation compression and removal of stale log files,
-// starting the mill goroutine if necessary and sending a signal to it.
-func (l *Logger) mill() {
-	if atomic.LoadUint32(&l.isClosed) == 1 {
-		return // Don't run if logger is closed
+// Manifest events.
+const (
+	manifestRotate   = "rotate"
+	manifestCompress = "compress"
+	manifestRemove   = "remove"
+)
+
+// ManifestEntry is one line of the manifest written when Manifest is set.
+// Names are relative to the backup directory (BackupDir, or the directory of
+// the log file).
+type ManifestEntry struct {
+	Event       string    `json:"event"`            // "rotate", "compress" or "remove"
+	Name        string    `json:"name"`             // the backup the event is about
+	Source      string    `json:"source,omitempty"` // for "compress": the uncompressed backup it replaces
+	Reason      string    `json:"reason,omitempty"` // for "rotate" and "compress": why the file was rotated
+	Start       time.Time `json:"start"`            // start of the segment, if known
+	End         time.Time `json:"end"`              // time of the rotation (or of the event)
+	Size        int64     `json:"size"`             // size of the backup in bytes
+	SHA256      string    `json:"sha256,omitempty"` // hex SHA-256 of the backup
+	Compression string    `json:"compression"`      // "none" | "gzip" | "zstd"
+	Encrypted   bool      `json:"encrypted,omitempty"`
+}
+
+// manifestPath returns the path of the manifest file.
+func (l *Logger) manifestPath() string {
+	return l.filename() + ".manifest.jsonl"
+}
+
+// rotationRecord is a rotation to record in the manifest and the hash chain.
+type rotationRecord struct {
+	backup, reason string
+	start, end     time.Time
+	size           int64
+	sum            string // hex SHA-256 of the backup, "" if not known yet
+}
+
+// recordRotation records the backup of the segment that ran from start to
+// end. If the segment wasn't entirely written by this Logger (e.g. it was
+// reopened after a restart), checksumming the backup is left to the mill, so
+// that writers don't wait for it; the rotations after it wait in line too, to
+// stay in order. It expects l.mu to be held.
+func (l *Logger) recordRotation(backup, reason string, start, end time.Time) {
+	if !l.Manifest && !l.HashChain {
+		return
 	}
-	l.startMill.Do(func() {
-		l.millCh = make(chan bool, 1) // Buffered channel of 1
-		go l.millRun()
+	info, err := os.Stat(backup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to stat %s: %v\n", l.Filename, backup, err)
+		return
+	}
+	r := rotationRecord{backup: backup, reason: reason, start: start, end: end, size: info.Size()}
+	if l.segmentHash != nil && l.segmentHashed == info.Size() {
+		r.sum = hex.EncodeToString(l.segmentHash.Sum(nil))
+	}
+
+	l.manifestMu.Lock()
+	if r.sum == "" || len(l.unrecorded) > 0 {
+		l.unrecorded = append(l.unrecorded, r)
+		l.manifestMu.Unlock()
+		return
+	}
+	l.manifestMu.Unlock()
+	l.writeRotationRecord(r)
+}
+
+// recordPendingRotations records the rotations left to the mill by
+// recordRotation, in order, checksumming their backups. It is called by the mill.
+func (l *Logger) recordPendingRotations() {
+	for {
+		l.manifestMu.Lock()
+		if len(l.unrecorded) == 0 {
+			l.manifestMu.Unlock()
+			return
+		}
+		r := l.unrecorded[0]
+		l.manifestMu.Unlock()
+
+		var err error
+		if r.sum == "" {
+			if r.sum, _, err = hashFile(r.backup); err != nil {
+				fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to checksum %s: %v\n", l.Filename, r.backup, err)
+			}
+		}
+		if err == nil {
+			l.writeRotationRecord(r)
+		}
+
+		// Dequeue only now, so that new rotations keep waiting in line.
+		l.manifestMu.Lock()
+		l.unrecorded = l.unrecorded[1:]
+		l.manifestMu.Unlock()
+	}
+}
+
+// writeRotationRecord appends r to the hash chain and the manifest.
+func (l *Logger) writeRotationRecord(r rotationRecord) {
+	if l.HashChain {
+		l.appendChain(chainSegment, l.manifestName(r.backup), r.sum)
+	}
+	if !l.Manifest {
+		return
+	}
+	l.appendManifest(ManifestEntry{
+		Event:       manifestRotate,
+		Name:        l.manifestName(r.backup),
+		Reason:      r.reason,
+		Start:       r.start,
+		End:         r.end,
+		Size:        r.size,
+		SHA256:      r.sum,
+		Compression: "none",
 	})
-	select {
-	case l.millCh <- true: // Send signal to run millRunOnce
-	default: // Don't block if channel is full (mill is already busy)
+}
+
+// recordCompression appends a "compress" entry for the archive (compressed
+// and/or encrypted) that replaced src. segments are the entries of the
+// manifest, read once per mill pass.
+func (l *Logger) recordCompression(src, archive string, segments map[string]ManifestEntry) {
+	if !l.Manifest {
+		return
 	}
+	sum, size, err := hashFile(archive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to checksum %s for the manifest: %v\n", l.Filename, archive, err)
+		return
+	}
+	alg, encrypted := archiveFormat(archive)
+	start, reason := l.segmentOf(src, segments)
+	l.appendManifest(ManifestEntry{
+		Event:       manifestCompress,
+		Name:        l.manifestName(archive),
+		Source:      l.manifestName(src),
+		Reason:      reason,
+		Start:       start,
+		End:         currentTime(),
+		Size:        size,
+		SHA256:      sum,
+		Compression: alg,
+		Encrypted:   encrypted,
+	})
 }
 
-// oldLogFiles returns the list of backup log files stored in the same
-// directory as the current log file, sorted by their embedded timestamp (newest first).
-func (l *Logger) oldLogFiles() ([]logInfo, error) {
-	entries, err := os.ReadDir(l.dir()) // ReadDir is generally preferred over ReadFile for directory listings
+// segmentOf returns the start of the segment in the backup src and the reason
+// of its rotation, from its "rotate" entry in segments. Without one, the
+// reason is parsed from the name and the start is unknown.
+func (l *Logger) segmentOf(src string, segments map[string]ManifestEntry) (time.Time, string) {
+	if e, ok := segments[l.manifestName(src)]; ok {
+		return e.Start, e.Reason
+	}
+	prefix, ext := l.prefixAndExt()
+	_, _, reason, _ := l.parseBackupFile(filepath.Base(src), prefix, ext)
+	return time.Time{}, reason
+}
+
+// manifestSegments returns the entries of the manifest for segmentOf, or nil
+// if it can't be read.
+func (l *Logger) manifestSegments() map[string]ManifestEntry {
+	l.manifestMu.Lock()
+	defer l.manifestMu.Unlock()
+	live, err := l.readManifest()
+	if err != nil {
+		return nil
+	}
+	return live
+}
+
+// recordRemoval appends a "remove" entry for a deleted backup.
+func (l *Logger) recordRemoval(name string) {
+	if l.HashChain {
+		l.appendChain(chainPrune, l.manifestName(name), "")
+	}
+	if !l.Manifest {
+		return
+	}
+	l.appendManifest(ManifestEntry{Event: manifestRemove, Name: l.manifestName(name), End: currentTime()})
+}
+
+// manifestName returns the name a backup is listed under in the manifest.
+func (l *Logger) manifestName(path string) string {
+	if rel, err := filepath.Rel(l.backupDir(), path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(path)
+}
+
+// appendManifest appends an entry to the manifest file, reporting (but
+// otherwise ignoring) failures.
+func (l *Logger) appendManifest(e ManifestEntry) {
+	l.manifestMu.Lock()
+	defer l.manifestMu.Unlock()
+	if err := l.appendJSONLine(l.manifestPath(), e); err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to update manifest: %v\n", l.Filename, err)
+	}
+}
+
+// appendJSONLine appends v as one line of JSON to the named file, syncing it
+// if rotations should be made durable.
+func (l *Logger) appendJSONLine(name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, statErr := os.Stat(name)
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, l.fileMode(nil))
+	if err != nil {
+		return err
+	}
+	if os.IsNotExist(statErr) {
+		l.setPermissions(name, l.FileMode, nil)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err == nil && l.syncOnRotate() {
+		err = fileSync(f)
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// readManifest replays the manifest and returns the entries of the backups
+// that should currently exist, keyed by name.
+func (l *Logger) readManifest() (map[string]ManifestEntry, error) {
+	live := make(map[string]ManifestEntry)
+	f, err := os.Open(l.manifestPath())
+	if os.IsNotExist(err) {
+		return live, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("can't read log file directory: %s", err)
+		return nil, fmt.Errorf("can't open manifest: %w", err)
 	}
-	var logFiles []logInfo
-
-	prefix, ext := l.prefixAndExt() // Get prefix like "filename-" and original extension like ".log"
+	defer f.Close()
 
-	for _, e := range entries {
-		if e.IsDir() { // Skip directories
-			continue
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var e ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("malformed manifest line %d: %w", line, err)
 		}
-		name := e.Name()
-		info, errInfo := e.Info() // Get FileInfo for modification time and other details
-		if errInfo != nil {
-			// fmt.Fprintf(os.Stderr, "timberjack: failed to get FileInfo for %s: %v\n", name, errInfo)
-			continue // Skip files we can't stat
+		switch e.Event {
+		case manifestRotate:
+			live[e.Name] = e
+		case manifestCompress:
+			delete(live, e.Source)
+			live[e.Name] = e
+		case manifestRemove:
+			delete(live, e.Name)
 		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read manifest: %w", err)
+	}
+	return live, nil
+}
 
-		// Attempt to parse timestamp from filename (e.g., from "filename-timestamp-reason.log")
-		if t, errTime := l.timeFromName(name, prefix, ext); errTime == nil {
-			logFiles = append(logFiles, logInfo{t, info})
-			continue
-		}
-		// Attempt to parse timestamp from compressed gzip filename (e.g., from "filename-timestamp-reason.log.gz")
-		if t, errTime := l.timeFromName(name, prefix, ext+compressSuffix); errTime == nil {
-			logFiles = append(logFiles, logInfo{t, info})
-			continue
+// VerifyManifest checks the backups on disk against the manifest. It returns a
+// *VerifyError for every backup that is missing, whose size or SHA-256
+// differs from its entry, or that exists without being listed. The error is
+// non-nil only if the manifest or the backups can't be read.
+func (l *Logger) VerifyManifest() ([]*VerifyError, error) {
+	live, err := l.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	root := l.backupDir()
+	names := make([]string, 0, len(live))
+	for name := range live {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var failed []*VerifyError
+	for _, name := range names {
+		e := live[name]
+		path := filepath.Join(root, filepath.FromSlash(name))
+		sum, size, err := hashFile(path)
+		switch {
+		case os.IsNotExist(err):
+			failed = append(failed, &VerifyError{Name: path, Err: ErrBackupMissing})
+		case err != nil:
+			failed = append(failed, &VerifyError{Name: path, Err: err})
+		case size != e.Size:
+			failed = append(failed, &VerifyError{Name: path, Err: ErrSizeMismatch})
+		case sum != e.SHA256:
+			failed = append(failed, &VerifyError{Name: path, Err: ErrChecksumMismatch})
 		}
-		// Attempt to parse timestamp from compressed zstd filename (e.g., from "filename-timestamp-reason.log.zst")
-		if t, errTime := l.timeFromName(name, prefix, ext+zstdSuffix); errTime == nil {
-			logFiles = append(logFiles, logInfo{t, info})
-			continue
+	}
+	for _, f := range files {
+		if _, ok := live[l.manifestName(f.path())]; !ok {
+			failed = append(failed, &VerifyError{Name: f.path(), Err: ErrNotInManifest})
 		}
-		// Files that don't match the expected backup pattern are ignored.
 	}
+	return failed, nil
+}
 
-	sort.Sort(byFormatTime(logFiles)) // Sorts newest first based on parsed timestamp
-	return logFiles, nil
+// Chain link events.
+const (
+	chainSegment = "segment"
+	chainPrune   = "prune"
+)
+
+// ChainLink is one line of the hash chain written when HashChain is set.
+type ChainLink struct {
+	Seq    int    `json:"seq"`              // 1 for the first link, then increasing by one
+	Event  string `json:"event"`            // "segment" for a rotation, "prune" for a removal by the mill
+	Name   string `json:"name"`             // backup name at rotation, relative to the backup directory
+	SHA256 string `json:"sha256,omitempty"` // for "segment": hex SHA-256 of the uncompressed segment
+	Prev   string `json:"prev"`             // digest of the previous link, "" for the first
+	Digest string `json:"digest"`           // hex SHA-256 over all the fields above
+	Sig    string `json:"sig,omitempty"`    // base64 ed25519 signature of the digest, with ChainSigningKey
 }
 
-// timeFromName extracts the formatted timestamp from the backup filename.
-// It expects filenames like "prefix-YYYY-MM-DDTHH-MM-SS.mmm-reason.ext" or "prefix.ext-YYYY-MM-DDTHH-MM-SS.mmm-reason[.gz]"
-func (l *Logger) timeFromName(filename, prefix, ext string) (time.Time, error) {
-	layout := l.BackupTimeFormat
-	if layout == "" {
-		layout = backupTimeFormat
-	}
-	loc := time.UTC
-	if l.LocalTime {
-		loc = time.Local
-	}
+// digest computes the digest committing to the link and its predecessor.
+func (c ChainLink) digest() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("timberjack-chain-v1\n%d\n%s\n%s\n%s\n%s\n", c.Seq, c.Event, c.Name, c.SHA256, c.Prev)))
+	return hex.EncodeToString(sum[:])
+}
 
-	if !l.AppendTimeAfterExt {
+// chainPath returns the path of the hash chain file.
+func (l *Logger) chainPath() string {
+	return l.filename() + ".chain.jsonl"
+}
 
-		// Keep legacy behavior for error messages to satisfy existing tests
-		if !strings.HasPrefix(filename, prefix) {
-			return time.Time{}, errors.New("mismatched prefix")
-		}
-		if !strings.HasSuffix(filename, ext) {
-			return time.Time{}, errors.New("mismatched extension")
+// appendChain appends a link to the hash chain, reporting (but otherwise
+// ignoring) failures.
+func (l *Logger) appendChain(event, name, sum string) {
+	l.chainMu.Lock()
+	defer l.chainMu.Unlock()
+
+	if !l.chainLoaded {
+		links, err := l.readChain()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to update hash chain: %v\n", l.Filename, err)
+			return
 		}
-		// "<prefix><timestamp>-<reason><ext>"
-		trimmed := filename[len(prefix) : len(filename)-len(ext)]
-		lastHyphenIdx := strings.LastIndex(trimmed, "-")
-		if lastHyphenIdx == -1 {
-			return time.Time{}, fmt.Errorf("malformed backup filename: missing reason separator in %q", trimmed)
+		if n := len(links); n > 0 {
+			l.chainSeq, l.chainHead = links[n-1].Seq, links[n-1].Digest
 		}
-		ts := trimmed[:lastHyphenIdx]
-		return time.ParseInLocation(layout, ts, loc)
+		l.chainLoaded = true
 	}
 
-	// After-ext parsing:
-	// base is "<name><ext>" (e.g., "foo.log")
-	base := prefix[:len(prefix)-1] + ext
-
-	// Allow optional trailing compression suffix (".gz" or ".zst")
-	nameNoComp := trimCompressionSuffix(filename)
-
-	// nameNoComp must start with "<base>-"
-	if !strings.HasPrefix(nameNoComp, base+"-") {
-		return time.Time{}, fmt.Errorf("malformed backup filename: %q", filename)
+	link := ChainLink{Seq: l.chainSeq + 1, Event: event, Name: name, SHA256: sum, Prev: l.chainHead}
+	link.Digest = link.digest()
+	if l.ChainSigningKey != nil {
+		link.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(l.ChainSigningKey, []byte(link.Digest)))
 	}
+	if err := l.appendJSONLine(l.chainPath(), link); err != nil {
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to update hash chain: %v\n", l.Filename, err)
+		return
+	}
+	l.chainSeq, l.chainHead = link.Seq, link.Digest
+}
 
-	// nameNoComp = "<base>-<timestamp>-<reason>"
-	trimmed := nameNoComp[len(base)+1:]
+// readChain returns the links of the hash chain, if any.
+func (l *Logger) readChain() ([]ChainLink, error) {
+	f, err := os.Open(l.chainPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't open hash chain: %w", err)
+	}
+	defer f.Close()
 
-	lastHyphenIdx := strings.LastIndex(trimmed, "-")
-	if lastHyphenIdx == -1 {
-		return time.Time{}, fmt.Errorf("malformed backup filename: %q", filename)
+	var links []ChainLink
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var c ChainLink
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("malformed hash chain line %d: %w", line, err)
+		}
+		links = append(links, c)
 	}
-	ts := trimmed[:lastHyphenIdx]
-	return time.ParseInLocation(layout, ts, loc)
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read hash chain: %w", err)
+	}
+	return links, nil
 }
 
-// max returns the maximum size in bytes of log files before rolling.
-func (l *Logger) max() int64 {
-	if l.MaxSize == 0 { // If MaxSize is 0, use default.
-		return int64(defaultMaxSize * megabyte)
+// VerifyChain checks the hash chain and the backups it covers. Every link must
+// follow its predecessor and, if pub is non-nil, carry a valid signature by
+// the matching ChainSigningKey. Every segment that wasn't pruned by the mill
+// must exist, compressed or not, with the recorded content. It returns a
+// *VerifyError for every problem found; the error is non-nil only if the
+// chain can't be read.
+func (l *Logger) VerifyChain(pub ed25519.PublicKey) ([]*VerifyError, error) {
+	links, err := l.readChain()
+	if err != nil {
+		return nil, err
 	}
-	return int64(l.MaxSize) * int64(megabyte)
-}
 
-// dir returns the directory for the current filename.
-func (l *Logger) dir() string {
-	return filepath.Dir(l.filename())
-}
+	var failed []*VerifyError
+	prev := ChainLink{}
+	segments := make(map[string]ChainLink)
+	var order []string
+	for _, c := range links {
+		switch {
+		case c.Seq != prev.Seq+1 || c.Prev != prev.Digest || c.Digest != c.digest():
+			failed = append(failed, &VerifyError{Name: c.Name, Err: fmt.Errorf("link %d: %w", c.Seq, ErrChainBroken)})
+		case pub != nil && !verifyChainSig(pub, c):
+			failed = append(failed, &VerifyError{Name: c.Name, Err: fmt.Errorf("link %d: %w", c.Seq, ErrBadSignature)})
+		}
+		prev = c
+
+		switch c.Event {
+		case chainSegment:
+			segments[c.Name] = c
+			order = append(order, c.Name)
+		case chainPrune:
+			// The mill records the name it removed, which may be compressed.
+			name := trimCompressionSuffix(c.Name)
+			delete(segments, name)
+		}
+	}
 
-// prefixAndExt returns the filename part (up to the extension, with a trailing dash for backups)
-// and extension part from the Logger's filename.
-// e.g., for "foo.log", returns "foo-", ".log"
-func (l *Logger) prefixAndExt() (prefix, ext string) {
-	filename := filepath.Base(l.filename())
-	ext = filepath.Ext(filename)
-	prefix = filename[:len(filename)-len(ext)] + "-" // Add dash as backup filenames include it after original prefix
-	return prefix, ext
+	root := l.backupDir()
+	for _, name := range order {
+		c, ok := segments[name]
+		if !ok {
+			continue // pruned
+		}
+		delete(segments, name) // check each name once
+		path := filepath.Join(root, filepath.FromSlash(name))
+		sum, err := hashBackupContent(path, l.KeyProvider)
+		switch {
+		case os.IsNotExist(err):
+			failed = append(failed, &VerifyError{Name: path, Err: ErrBackupMissing})
+		case err != nil:
+			failed = append(failed, &VerifyError{Name: path, Err: err})
+		case sum != c.SHA256:
+			failed = append(failed, &VerifyError{Name: path, Err: ErrChecksumMismatch})
+		}
+	}
+	return failed, nil
 }
 
-// countDigitsAfterDot returns the number of consecutive digit characters
-// immediately following the first '.' in the input.
-// It skips all characters before the '.' and stops counting at the first non-digit
-// character after the '.'.
+// verifyChainSig reports whether c carries a valid signature by pub.
+func verifyChainSig(pub ed25519.PublicKey, c ChainLink) bool {
+	sig, err := base64.StdEncoding.DecodeString(c.Sig)
+	return err == nil && ed25519.Verify(pub, []byte(c.Digest), sig)
+}
 
-// Example: `prefix.0012304123suffix` would return 10
-// Example: `prefix.0012304_middle_123_suffix` would return 7
-func countDigitsAfterDot(layout string) int {
-	for i, ch := range layout {
-		if ch == '.' {
-			count := 0
-			for _, c := range layout[i+1:] {
-				if unicode.IsDigit(c) {
-					count++
-				} else {
-					break
-				}
+// hashBackupContent returns the hex SHA-256 of the original content of the
+// backup at path, which may since have been compressed or encrypted.
+func hashBackupContent(path string, keys KeyProvider) (string, error) {
+	for _, suffix := range archiveSuffixes {
+		if _, err := os.Stat(path + suffix); err == nil {
+			h := sha256.New()
+			if err := decodeArchive(path+suffix, path+suffix, keys, h); err != nil {
+				return "", err
 			}
-			return count
+			return hex.EncodeToString(h.Sum(nil)), nil
 		}
 	}
-	return 0 // no '.' found or no digits after dot
+	sum, _, err := hashFile(path)
+	return sum, err
 }
 
-// truncateFractional truncates time t to n fractional digits of seconds.
-// n=0 → truncate to seconds, n=3 → milliseconds, n=6 → microseconds, etc.
-func truncateFractional(t time.Time, n int) (time.Time, error) {
-	if n < 0 || n > 9 {
-		return time.Time{}, fmt.Errorf("unsupported fractional precision: %d", n)
+// hashFile returns the hex SHA-256 and the size of the named file.
+func hashFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
 	}
-
-	// number of nanoseconds to keep
-	factor := math.Pow10(9 - n) // e.g. for n=3, factor=10^(9-3)=1,000,000
-
-	nanos := t.Nanosecond()
-	truncatedNanos := int((int64(nanos) / int64(factor)) * int64(factor))
-
-	return time.Date(
-		t.Year(), t.Month(), t.Day(),
-		t.Hour(), t.Minute(), t.Second(),
-		truncatedNanos,
-		t.Location(),
-	), nil
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
 }
 
 // compressLogFile compresses the given source log file (src) to a destination file (dst),
 // removing the source file if compression is successful.
 func compressLogFile(src, dst string) error {
+	return archiveLogFile(src, dst, archiveOptions{uid: -1, gid: -1})
+}
+
+// archiveOptions controls archiveLogFile.
+type archiveOptions struct {
+	verify   bool        // decode and compare the archive before removing the source
+	keys     KeyProvider // keys to encrypt with, for dst ending in ".enc"
+	mode     os.FileMode // mode of the archive; the source's mode if zero
+	uid, gid int         // ownership of the archive; the source's if both are -1
+}
+
+// archiveLogFile is compressLogFile that also encrypts with opts.keys if dst
+// ends in ".enc" (compressing first if the rest of dst ends in ".gz" or ".zst").
+// If opts.verify is set, it decodes the archive before it's published and keeps
+// the source, returning a *VerifyError, if the content doesn't match.
+func archiveLogFile(src, dst string, opts archiveOptions) error {
+	verify, keys := opts.verify, opts.keys
 	srcFile, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open source log file %s for compression: %v", src, err)
@@ -1172,53 +3489,123 @@ func compressLogFile(src, dst string) error {
 		return fmt.Errorf("failed to stat source log file %s: %v", src, err)
 	}
 
-	// Create or open the destination file for writing the compressed content
-	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, srcInfo.Mode())
+	// Write the compressed content to a hidden temporary file next to dst and
+	// rename it into place once it's complete, so dst is never seen truncated.
+	tmp := compressTempName(dst)
+	mode := srcInfo.Mode()
+	if opts.mode != 0 {
+		mode = opts.mode
+	}
+	dstFile, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
 	if err != nil {
 		return fmt.Errorf("failed to open destination compressed log file %s: %v", dst, err)
 	}
+	if opts.mode != 0 {
+		_ = dstFile.Chmod(opts.mode) // regardless of the umask
+	}
 	// No `defer dstFile.Close()` here, explicit closing in sequence is critical.
 
 	var copyErr error // To capture error from io.Copy
 
+	// Checksum the source as it's read, for verification.
+	srcHash := sha256.New()
+	var in io.Reader = srcFile
+	if verify {
+		in = io.TeeReader(srcFile, srcHash)
+	}
+
+	// Encrypt everything written to out, if dst asks for it.
+	var out io.Writer = dstFile
+	plainDst := strings.TrimSuffix(dst, encSuffix)
+	var encW *encryptWriter
+	if plainDst != dst {
+		if keys == nil {
+			err = errors.New("no KeyProvider")
+		} else {
+			encW, err = newEncryptWriter(dstFile, keys)
+		}
+		if err != nil {
+			_ = dstFile.Close()
+			_ = osRemove(tmp)
+			return fmt.Errorf("failed to init encryption for %s: %v", dst, err)
+		}
+		out = encW
+	}
+
 	// Choose compression algorithm based on dst suffix
-	// Default to gzip if no recognized suffix
+	// Default to gzip if no recognized suffix, unless only encrypting
 	// This allows future extension to other algorithms by checking dst suffix
-	if strings.HasSuffix(dst, zstdSuffix) {
-		enc, err := zstd.NewWriter(dstFile)
+	if strings.HasSuffix(plainDst, zstdSuffix) {
+		enc, err := zstd.NewWriter(out)
 		if err != nil { // Error creating zstd writer
 			_ = dstFile.Close() // Close dstFile before removing
-			_ = osRemove(dst)   // Remove potentially partial dst file
+			_ = osRemove(tmp)   // Remove potentially partial temp file
 			return fmt.Errorf("failed to init zstd writer for %s: %v", dst, err)
 		}
-		_, copyErr = io.Copy(enc, srcFile) // Copy data from source file to zstd writer
-		closeErr := enc.Close()            // Close zstd writer to flush data
+		_, copyErr = io.Copy(enc, in) // Copy data from source file to zstd writer
+		closeErr := enc.Close()       // Close zstd writer to flush data
 		if copyErr == nil && closeErr != nil {
 			copyErr = closeErr
 		}
+	} else if encW != nil && !strings.HasSuffix(plainDst, compressSuffix) {
+		_, copyErr = io.Copy(out, in) // Encrypt without compressing
 	} else {
-		gz := gzip.NewWriter(dstFile)     // Default to gzip
-		_, copyErr = io.Copy(gz, srcFile) // Copy data from source file to gzip writer
-		closeErr := gz.Close()            // Close gzip writer to flush data
+		gz := gzip.NewWriter(out)    // Default to gzip
+		_, copyErr = io.Copy(gz, in) // Copy data from source file to gzip writer
+		closeErr := gz.Close()       // Close gzip writer to flush data
 		if copyErr == nil && closeErr != nil {
 			copyErr = closeErr
 		}
 	}
+	if encW != nil {
+		if closeErr := encW.Close(); copyErr == nil { // Write the last encrypted chunk
+			copyErr = closeErr
+		}
+	}
 
 	if copyErr != nil { // Error during copy or close
 		_ = dstFile.Close() // Try to close destination file
-		_ = osRemove(dst)   // Try to remove potentially partial destination file
+		_ = osRemove(tmp)   // Try to remove potentially partial temp file
 		return fmt.Errorf("failed to write compressed data to %s: %w", dst, copyErr)
 	}
 
+	// Make sure the compressed data is on stable storage before the source is
+	// removed, so a crash can't lose both copies.
+	if err := fileSync(dstFile); err != nil {
+		_ = dstFile.Close()
+		_ = osRemove(tmp)
+		return fmt.Errorf("failed to sync compressed file %s: %w", dst, err)
+	}
+
 	if err := dstFile.Close(); err != nil { // Close destination file
-		// Data is likely written and compressor closed successfully, but closing the file descriptor failed.
-		// The destination file might still be valid on disk. We typically wouldn't remove dst here
-		// as the data might be recoverable or fully written despite the close error.
+		// The data may well be complete, but we can't be sure, so don't publish it.
+		// The source is kept and compressed again on the next mill run.
+		_ = osRemove(tmp)
 		return fmt.Errorf("failed to close destination compressed file %s: %w", dst, err)
 	}
 
-	if errChown := chown(dst, srcInfo); errChown != nil { // Attempt to chown the destination file
+	if verify {
+		dstHash := sha256.New()
+		errVerify := decodeArchive(tmp, dst, keys, dstHash)
+		if errVerify == nil && !bytes.Equal(srcHash.Sum(nil), dstHash.Sum(nil)) {
+			errVerify = ErrChecksumMismatch
+		}
+		if errVerify != nil {
+			_ = osRemove(tmp)
+			return &VerifyError{Name: dst, Err: errVerify}
+		}
+	}
+
+	if err := osRename(tmp, dst); err != nil {
+		_ = osRemove(tmp)
+		return fmt.Errorf("failed to rename compressed file into place %s: %w", dst, err)
+	}
+
+	errChown := chown(dst, srcInfo) // Attempt to chown the destination file like the source
+	if opts.uid != -1 || opts.gid != -1 {
+		errChown = chownIDs(dst, opts.uid, opts.gid) // or as configured
+	}
+	if errChown != nil {
 		// Log the chown error, but don't make it a fatal error for the compression process itself,
 		// as the compressed file is valid. The original source file will still be removed.
 		fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to chown compressed log file %s: %v (source %s)\n",
@@ -1227,6 +3614,11 @@ func compressLogFile(src, dst string) error {
 		// For now, it's logged, and compression proceeds to remove the source.
 	}
 
+	// The rename must be durable before the source goes away.
+	if err := syncDir(filepath.Dir(dst)); err != nil {
+		return fmt.Errorf("failed to sync directory of compressed file %s: %w", dst, err)
+	}
+
 	// Close srcFile before removing it. On Windows the file must be closed before it
 	// can be deleted (see the comment near the top of this function). All reads from
 	// srcFile are finished by this point, so closing here is safe. We set the flag so
@@ -1245,6 +3637,202 @@ func compressLogFile(src, dst string) error {
 
 }
 
+// compressTempName returns the hidden temporary name a compressed file is
+// written under before it is renamed to dst.
+func compressTempName(dst string) string {
+	return filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+compressTempSuffix)
+}
+
+// validateArchive fully decodes a compressed or encrypted backup, which
+// verifies its checksums and trailer, and reports whether it is complete.
+func validateArchive(name string, keys KeyProvider) error {
+	return decodeArchive(name, name, keys, io.Discard)
+}
+
+// decodeArchive decodes the file name into w, as if it were named dst (the
+// name the archive is published under).
+func decodeArchive(name, dst string, keys KeyProvider, w io.Writer) error {
+	r, err := openBackupAs(name, dst, keys)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// OpenBackup opens a backup for reading its original content, decrypting it
+// with keys (".enc") and decompressing it (".gz", ".zst") as its name
+// requires. keys may be nil for backups that aren't encrypted.
+func OpenBackup(name string, keys KeyProvider) (io.ReadCloser, error) {
+	return openBackupAs(name, name, keys)
+}
+
+// backupReader reads the decoded content of a backup.
+type backupReader struct {
+	io.Reader
+	f    *os.File
+	done func() // releases the decompressor, if any
+}
+
+func (r *backupReader) Close() error {
+	if r.done != nil {
+		r.done()
+	}
+	return r.f.Close()
+}
+
+// openBackupAs opens the file name for decoding as if it were named as.
+func openBackupAs(name, as string, keys KeyProvider) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	br := &backupReader{Reader: f, f: f}
+
+	plain := strings.TrimSuffix(as, encSuffix)
+	if plain != as {
+		if keys == nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s is encrypted, but no KeyProvider was given", name)
+		}
+		if br.Reader, err = NewDecryptReader(br.Reader, keys); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(plain, zstdSuffix):
+		dec, err := zstd.NewReader(br.Reader)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		br.Reader, br.done = dec, dec.Close
+	case strings.HasSuffix(plain, compressSuffix):
+		gz, err := gzip.NewReader(br.Reader)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		br.Reader, br.done = gz, func() { _ = gz.Close() }
+	}
+	return br, nil
+}
+
+// recoverCompression cleans up after compressions that were interrupted by a
+// crash: it removes leftover temporary files and, for every backup that exists
+// both compressed and uncompressed, keeps the archive only if it is complete
+// and the uncompressed file otherwise. An archive, or temporary file, whose
+// uncompressed backup is gone is the only copy: it is checked, and moved
+// aside with the ".corrupt" suffix if it is incomplete.
+func (l *Logger) recoverCompression() {
+	prefix, ext := l.prefixAndExt()
+	var temps []string
+	_ = l.walkBackupFiles(func(dir string, e fs.DirEntry) {
+		name := e.Name()
+		if !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, compressTempSuffix) {
+			return
+		}
+		inner := strings.TrimSuffix(name[1:], compressTempSuffix)
+		if !isArchived(inner) {
+			return
+		}
+		if _, _, _, err := l.parseBackupFile(inner, prefix, ext); err == nil {
+			temps = append(temps, filepath.Join(dir, name))
+		}
+	})
+	var segments map[string]ManifestEntry // read on the first recovered compression
+	for _, name := range temps {
+		archive := filepath.Join(filepath.Dir(name), strings.TrimSuffix(filepath.Base(name)[1:], compressTempSuffix))
+		src := trimCompressionSuffix(archive)
+		if !fileExists(src) && !fileExists(archive) {
+			if l.keepOrphanArchive(name, archive) {
+				if segments == nil && l.Manifest {
+					segments = l.manifestSegments()
+				}
+				l.recordCompression(src, archive, segments)
+			}
+			continue
+		}
+		if err := osRemove(name); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to remove temporary file %s: %v\n", l.Filename, name, err)
+		}
+	}
+
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return
+	}
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		present[f.path()] = true
+	}
+	var orphan logInfo // the newest archive whose source is gone
+	for _, f := range files {
+		archive := f.path()
+		src := trimCompressionSuffix(archive)
+		if src == archive {
+			continue
+		}
+		if !present[src] {
+			if orphan.FileInfo == nil || f.ModTime().After(orphan.ModTime()) {
+				orphan = f
+			}
+			continue
+		}
+		if errValid := validateArchive(archive, l.KeyProvider); errValid != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] removing incomplete compressed log file %s: %v\n", l.Filename, archive, errValid)
+			if err := osRemove(archive); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to remove %s: %v\n", l.Filename, archive, err)
+			}
+			continue
+		}
+		// The archive is complete; the crash happened before the source was removed.
+		if err := osRemove(src); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to remove compressed log file source %s: %v\n", l.Filename, src, err)
+		} else {
+			if segments == nil && l.Manifest {
+				segments = l.manifestSegments()
+			}
+			l.recordCompression(src, archive, segments)
+		}
+	}
+
+	// The mill compresses one backup at a time, so only the last archive it
+	// wrote can have been cut short by a crash after its source was removed.
+	if orphan.FileInfo != nil {
+		l.keepOrphanArchive(orphan.path(), orphan.path())
+	}
+}
+
+// keepOrphanArchive checks name, an archive (or temporary file of one) whose
+// uncompressed backup is gone, and moves it to archive if it is complete, or
+// aside to archive+".corrupt" otherwise, reporting it. It reports whether the
+// archive was kept.
+func (l *Logger) keepOrphanArchive(name, archive string) bool {
+	errValid := decodeArchive(name, archive, l.KeyProvider, io.Discard)
+	dest := archive
+	if errValid != nil {
+		dest = archive + corruptSuffix
+		fmt.Fprintf(os.Stderr, "timberjack: [%s] compressed log file %s is incomplete and its source is gone, moving it to %s: %v\n", l.Filename, name, dest, errValid)
+	}
+	if name != dest {
+		if err := osRename(name, dest); err != nil {
+			fmt.Fprintf(os.Stderr, "timberjack: [%s] failed to move %s to %s: %v\n", l.Filename, name, dest, err)
+			return false
+		}
+	}
+	return errValid == nil
+}
+
+// fileExists reports whether name exists.
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return !os.IsNotExist(err)
+}
+
 // effectiveCompression returns "none" | "gzip" | "zstd".
 // Rule: if Compression is set, it wins; if empty, fallback to legacy Compress.
 // Unknown strings default to "none" (and warn once).
@@ -1276,8 +3864,42 @@ func (l *Logger) compressedSuffix() string {
 	}
 }
 
-// trimCompressionSuffix strips one known compression suffix (".gz" or ".zst").
+// archiveSuffix returns the suffix the mill gives backups: the compression
+// suffix, followed by ".enc" if backups are encrypted. It is "" if the mill
+// leaves backups as they are.
+func (l *Logger) archiveSuffix() string {
+	if l.KeyProvider != nil {
+		return l.compressedSuffix() + encSuffix
+	}
+	return l.compressedSuffix()
+}
+
+// archiveSuffixes lists the suffixes of backups processed by the mill.
+var archiveSuffixes = []string{compressSuffix, zstdSuffix, encSuffix, compressSuffix + encSuffix, zstdSuffix + encSuffix}
+
+// isArchived reports whether name is a compressed or encrypted backup.
+func isArchived(name string) bool {
+	return trimCompressionSuffix(name) != name
+}
+
+// archiveFormat returns the compression algorithm of a backup from its name,
+// "none", "gzip" or "zstd", and whether it's encrypted.
+func archiveFormat(name string) (string, bool) {
+	plain := strings.TrimSuffix(name, encSuffix)
+	switch {
+	case strings.HasSuffix(plain, compressSuffix):
+		return "gzip", plain != name
+	case strings.HasSuffix(plain, zstdSuffix):
+		return "zstd", plain != name
+	default:
+		return "none", plain != name
+	}
+}
+
+// trimCompressionSuffix strips the suffixes added by the mill: ".enc", then
+// one known compression suffix (".gz" or ".zst").
 func trimCompressionSuffix(name string) string {
+	name = strings.TrimSuffix(name, encSuffix)
 	name = strings.TrimSuffix(name, compressSuffix)
 	name = strings.TrimSuffix(name, zstdSuffix)
 	return name
@@ -1320,6 +3942,34 @@ func sanitizeReason(s string) string {
 type logInfo struct {
 	timestamp   time.Time // Parsed timestamp from the filename
 	os.FileInfo           // Full FileInfo
+	dir         string    // Directory the file was found in
+	seq         int       // Sequence number from the filename (BackupSequence), or 0
+	reason      string    // Reason from the filename, "" for time-stamped segments
+}
+
+// rotationKey identifies the rotation event a backup belongs to.
+type rotationKey struct {
+	timestamp time.Time
+	seq       int
+}
+
+// key returns the rotation event the backup belongs to.
+func (li logInfo) key() rotationKey {
+	return rotationKey{li.timestamp, li.seq}
+}
+
+// path returns the full path of the backup file.
+func (li logInfo) path() string {
+	return filepath.Join(li.dir, li.Name())
+}
+
+// relName returns the backup's path relative to root, falling back to its base
+// name if it does not live under root.
+func (li logInfo) relName(root string) string {
+	if rel, err := filepath.Rel(root, li.path()); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return li.Name()
 }
 
 // byFormatTime sorts a slice of logInfo structs by their parsed timestamp in descending order (newest first).
@@ -1336,6 +3986,9 @@ func (b byFormatTime) Less(i, j int) bool {
 	if b[i].timestamp.IsZero() && b[j].timestamp.IsZero() {
 		return false
 	} // Equal if both are zero (order doesn't matter)
+	if b[i].timestamp.Equal(b[j].timestamp) {
+		return b[i].seq > b[j].seq // Same timestamp: higher sequence is newer
+	}
 	return b[i].timestamp.After(b[j].timestamp) // Sort newest first
 }
 func (b byFormatTime) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
@@ -3,17 +3,26 @@ package timberjack
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	_ "time/tzdata" // fixed DST rules for the scheduling tests
 
 	"github.com/fortytw2/leaktest"
 	"github.com/klauspost/compress/zstd"
@@ -345,7 +354,7 @@ func TestCleanupExistingBackups(t *testing.T) {
 	newFakeTime()
 
 	backup = backupFileWithReason(dir, "size")
-	err = os.WriteFile(backup+compressSuffix, data, 0644)
+	err = os.WriteFile(backup+compressSuffix, gzipped("data", t), 0644)
 	isNil(err, t)
 
 	newFakeTime()
@@ -735,6 +744,17 @@ func existsWithContent(path string, content []byte, t testing.TB) {
 	equalsUp(content, b, t, 1)
 }
 
+// gzipped returns content compressed with gzip, for fixtures that need a
+// complete archive.
+func gzipped(content string, t testing.TB) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	_, err := gz.Write([]byte(content))
+	isNilUp(err, t, 1)
+	isNilUp(gz.Close(), t, 1)
+	return b.Bytes()
+}
+
 // logFile returns the log file name in the given directory for the current fake
 // time.
 func logFile(dir string) string {
@@ -1011,15 +1031,15 @@ func TestSortByFormatTimeEdgeCases(t *testing.T) {
 	}{
 		{
 			"zero and valid timestamps",
-			[]logInfo{{t1, fi}, {t2, fi}},
+			[]logInfo{{timestamp: t1, FileInfo: fi}, {timestamp: t2, FileInfo: fi}},
 		},
 		{
 			"valid and zero timestamps",
-			[]logInfo{{t2, fi}, {t1, fi}},
+			[]logInfo{{timestamp: t2, FileInfo: fi}, {timestamp: t1, FileInfo: fi}},
 		},
 		{
 			"both zero timestamps",
-			[]logInfo{{t1, fi}, {t1, fi}},
+			[]logInfo{{timestamp: t1, FileInfo: fi}, {timestamp: t1, FileInfo: fi}},
 		},
 	}
 
@@ -1128,14 +1148,14 @@ func TestBackupName(t *testing.T) {
 	rotationTime := time.Date(2020, 1, 2, 3, 4, 5, 6_000_000, time.UTC)
 
 	// default (before-ext)
-	resultUTC := backupName(name, false, "size", rotationTime, backupTimeFormat, false)
+	resultUTC := backupName(name, time.UTC, "size", rotationTime, backupTimeFormat, false)
 	expectedUTC := "/tmp/test-2020-01-02T03-04-05.006-size.log"
 	if resultUTC != expectedUTC {
 		t.Errorf("expected %q, got %q", expectedUTC, resultUTC)
 	}
 
 	// after-ext
-	after := backupName(name, false, "size", rotationTime, backupTimeFormat, true)
+	after := backupName(name, time.UTC, "size", rotationTime, backupTimeFormat, true)
 	expectedAfter := "/tmp/test.log-2020-01-02T03-04-05.006-size"
 	if after != expectedAfter {
 		t.Errorf("expected %q, got %q", expectedAfter, after)
@@ -1915,7 +1935,8 @@ func TestMillRun_TriggersMillRunOnce_Effect(t *testing.T) {
 	}
 
 	// Start millRun in background
-	go l.millRun()
+	l.millWg.Add(1)
+	go l.millRun(l.millCh)
 
 	// Trigger it
 	l.millCh <- true
@@ -2402,7 +2423,8 @@ func TestLoggerClose_ClosesMillChannel(t *testing.T) {
 
 	// Set startMill to run millRun (to simulate actual usage)
 	logger.startMill.Do(func() {
-		go logger.millRun()
+		logger.millWg.Add(1)
+		go logger.millRun(logger.millCh)
 	})
 
 	// Close should close millCh
@@ -3054,3 +3076,2142 @@ func TestRotateWithReason_EmptyFallsBackToSizeWhenNotDue(t *testing.T) {
 		t.Fatalf("expected a rotated file with '-size.log' suffix when interval is not due")
 	}
 }
+
+func TestBackupDir_DatePartitioned(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	name := filepath.Join(dir, "app.log")
+
+	l := &Logger{
+		Filename:            name,
+		BackupDir:           "archive",
+		BackupDirTimeFormat: "2006/01/02",
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	writeOnce(t, l, "first\n")
+	if err := l.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	backup := filepath.Join(dir, "archive", "2025", "05", "01", "app-2025-05-01T10-00-00.000-size.log")
+	existsWithContent(backup, []byte("first\n"), t)
+	existsWithContent(name, []byte{}, t)
+
+	// Nothing but the live file and the archive tree is left in the log directory.
+	fileCount(dir, 2, t)
+}
+
+func TestBackupDir_MillPrunesTreeAndEmptyDirs(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = func() time.Time { return time.Date(2025, 5, 3, 10, 0, 0, 0, time.UTC) }
+
+	dir := mktempDir(t)
+	archive := filepath.Join(dir, "archive")
+	day1 := filepath.Join(archive, "2025", "05", "01")
+	day2 := filepath.Join(archive, "2025", "05", "02")
+	isNil(os.MkdirAll(day1, 0755), t)
+	isNil(os.MkdirAll(day2, 0755), t)
+	isNil(os.WriteFile(filepath.Join(day1, "app-2025-05-01T10-00-00.000-size.log"), []byte("day1\n"), 0644), t)
+	isNil(os.WriteFile(filepath.Join(day2, "app-2025-05-02T10-00-00.000-size.log"), []byte("day2\n"), 0644), t)
+
+	var cbDir string
+	var cbFiles []string
+	l := &Logger{
+		Filename:            filepath.Join(dir, "app.log"),
+		BackupDir:           archive,
+		BackupDirTimeFormat: "2006/01/02",
+		MaxBackups:          1,
+		Compression:         "gzip",
+		Callback: func(dir string, files []string) {
+			cbDir, cbFiles = dir, files
+		},
+	}
+
+	isNil(l.millRunOnce(), t)
+
+	// The older backup is removed together with its now empty date directory.
+	notExist(day1, t)
+	exists(filepath.Join(archive, "2025", "05"), t)
+
+	gz := filepath.Join(day2, "app-2025-05-02T10-00-00.000-size.log.gz")
+	exists(gz, t)
+
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(1, len(files), t)
+	equals(gz, files[0].path(), t)
+
+	equals(archive, cbDir, t)
+	equals([]string{filepath.Join("2025", "05", "02", "app-2025-05-02T10-00-00.000-size.log.gz")}, cbFiles, t)
+}
+
+func TestBackupSequence_SameTimestampDoesNotOverwrite(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = func() time.Time { return time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC) }
+
+	dir := mktempDir(t)
+	name := filepath.Join(dir, "app.log")
+
+	l := &Logger{
+		Filename:         name,
+		BackupTimeFormat: "2006-01-02T15-04-05",
+		BackupSequence:   true,
+	}
+
+	writeOnce(t, l, "one\n")
+	isNil(l.Rotate(), t)
+	writeOnce(t, l, "two\n")
+	isNil(l.Rotate(), t)
+	isNil(l.Close(), t)
+
+	existsWithContent(filepath.Join(dir, "app-2025-05-01T10-00-00-size-1.log"), []byte("one\n"), t)
+	existsWithContent(filepath.Join(dir, "app-2025-05-01T10-00-00-size-2.log"), []byte("two\n"), t)
+
+	// A new Logger picks the counter up from the existing backups.
+	l2 := &Logger{
+		Filename:         name,
+		BackupTimeFormat: "2006-01-02T15-04-05",
+		BackupSequence:   true,
+	}
+	defer l2.Close()
+	writeOnce(t, l2, "three\n")
+	isNil(l2.RotateWithReason("restart"), t)
+
+	existsWithContent(filepath.Join(dir, "app-2025-05-01T10-00-00-restart-3.log"), []byte("three\n"), t)
+
+	files, err := l2.oldLogFiles()
+	isNil(err, t)
+	equals(3, len(files), t)
+	equals([]int{3, 2, 1}, []int{files[0].seq, files[1].seq, files[2].seq}, t)
+}
+
+func TestBackupSequence_MaxBackupsCountsEachRotation(t *testing.T) {
+	dir := mktempDir(t)
+	for i, reason := range []string{"size-1", "size-2", "time-3"} {
+		name := filepath.Join(dir, "app.log-2025-05-01T10-00-00-"+reason)
+		isNil(os.WriteFile(name, []byte(strconv.Itoa(i)), 0644), t)
+	}
+	// Numeric custom reason without a sequence number still parses.
+	isNil(os.WriteFile(filepath.Join(dir, "app.log-2025-04-30T10-00-00-42"), []byte("old"), 0644), t)
+
+	l := &Logger{
+		Filename:           filepath.Join(dir, "app.log"),
+		BackupTimeFormat:   "2006-01-02T15-04-05",
+		AppendTimeAfterExt: true,
+		BackupSequence:     true,
+		MaxBackups:         2,
+	}
+	isNil(l.millRunOnce(), t)
+
+	exists(filepath.Join(dir, "app.log-2025-05-01T10-00-00-time-3"), t)
+	exists(filepath.Join(dir, "app.log-2025-05-01T10-00-00-size-2"), t)
+	notExist(filepath.Join(dir, "app.log-2025-05-01T10-00-00-size-1"), t)
+	notExist(filepath.Join(dir, "app.log-2025-04-30T10-00-00-42"), t)
+}
+
+func TestActiveFileTimeFormat_SymlinkRetargeted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	name := filepath.Join(dir, "app.log")
+
+	l := &Logger{
+		Filename:             name,
+		ActiveFileTimeFormat: "2006-01-02",
+	}
+	defer l.Close()
+
+	writeOnce(t, l, "day1\n")
+	target, err := os.Readlink(name)
+	isNil(err, t)
+	equals("app-2025-05-01.log", target, t)
+
+	now = now.AddDate(0, 0, 1)
+	isNil(l.Rotate(), t)
+	writeOnce(t, l, "day2\n")
+
+	// A second segment on the same day gets a collision suffix.
+	isNil(l.Rotate(), t)
+	writeOnce(t, l, "day2 again\n")
+
+	existsWithContent(filepath.Join(dir, "app-2025-05-01.log"), []byte("day1\n"), t)
+	existsWithContent(filepath.Join(dir, "app-2025-05-02.log"), []byte("day2\n"), t)
+	existsWithContent(filepath.Join(dir, "app-2025-05-02-1.log"), []byte("day2 again\n"), t)
+	existsWithContent(name, []byte("day2 again\n"), t)
+
+	target, err = os.Readlink(name)
+	isNil(err, t)
+	equals("app-2025-05-02-1.log", target, t)
+
+	// Only finalized segments count as backups; the live one is never touched.
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(2, len(files), t)
+	equals("app-2025-05-02.log", files[0].Name(), t)
+	equals("app-2025-05-01.log", files[1].Name(), t)
+}
+
+func TestActiveFileTimeFormat_Retention(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	name := filepath.Join(dir, "app.log")
+
+	// A plain file left by the default naming mode is rotated the usual way.
+	isNil(os.WriteFile(name, []byte("legacy\n"), 0644), t)
+
+	l := &Logger{
+		Filename:             name,
+		ActiveFileTimeFormat: "2006-01-02",
+		AppendTimeAfterExt:   true,
+		BackupDir:            "archive",
+		MaxBackups:           2,
+		Compression:          "gzip",
+	}
+
+	defer l.Close()
+
+	for i := 0; i < 3; i++ {
+		isNil(l.Rotate(), t)
+		writeOnce(t, l, fmt.Sprintf("segment %d\n", i))
+		now = now.AddDate(0, 0, 1)
+	}
+
+	// The archive holds the legacy backup plus two finalized segments; the oldest
+	// segment is pruned and the rest compressed by the mill.
+	archive := filepath.Join(dir, "archive")
+	_, err := waitForFileWithSuffix(t, archive, "app.log-2025-05-02.gz", 2*time.Second)
+	isNil(err, t)
+	_, err = waitForFileWithSuffix(t, archive, "app.log-2025-05-01T10-00-00.000-size.gz", 2*time.Second)
+	isNil(err, t)
+	notExist(filepath.Join(archive, "app.log-2025-05-01"), t)
+
+	// The live segment stays uncompressed next to the symlink.
+	existsWithContent(filepath.Join(dir, "app.log-2025-05-03"), []byte("segment 2\n"), t)
+	existsWithContent(name, []byte("segment 2\n"), t)
+}
+
+func loadDSTZone(t *testing.T) *time.Location {
+	t.Helper()
+	// Europe/Berlin springs forward 2025-03-30 02:00 -> 03:00 and
+	// falls back 2025-10-26 03:00 -> 02:00.
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	return loc
+}
+
+func TestNextScheduledRotation_DSTGap(t *testing.T) {
+	loc := loadDSTZone(t)
+	marks := []rotateAt{{2, 30}}
+	now := time.Date(2025, 3, 30, 1, 0, 0, 0, loc)
+
+	// shift: fire at the end of the gap, 03:00 CEST.
+	next, ok := nextScheduledRotation(now, marks, loc, dstShift, dstFirst)
+	assert(ok, t, "expected a next slot")
+	equals(time.Date(2025, 3, 30, 1, 0, 0, 0, time.UTC), next.UTC(), t)
+
+	// The shifted mark fires once, not again right after.
+	next, ok = nextScheduledRotation(next, marks, loc, dstShift, dstFirst)
+	assert(ok, t, "expected a next slot")
+	equals(time.Date(2025, 3, 31, 2, 30, 0, 0, loc), next, t)
+
+	// skip: nothing on the day of the transition.
+	next, ok = nextScheduledRotation(now, marks, loc, dstSkip, dstFirst)
+	assert(ok, t, "expected a next slot")
+	equals(time.Date(2025, 3, 31, 2, 30, 0, 0, loc), next, t)
+
+	// Marks around the gap are unaffected.
+	next, _ = nextScheduledRotation(now, []rotateAt{{3, 15}}, loc, dstSkip, dstFirst)
+	equals(time.Date(2025, 3, 30, 1, 15, 0, 0, time.UTC), next.UTC(), t)
+}
+
+func TestNextScheduledRotation_DSTOverlap(t *testing.T) {
+	loc := loadDSTZone(t)
+	marks := []rotateAt{{2, 30}}
+	now := time.Date(2025, 10, 26, 1, 0, 0, 0, loc)
+	first := time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC)  // 02:30 CEST
+	second := time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC) // 02:30 CET
+	tomorrow := time.Date(2025, 10, 27, 2, 30, 0, 0, loc)
+
+	next, _ := nextScheduledRotation(now, marks, loc, dstShift, dstFirst)
+	equals(first, next.UTC(), t)
+	next, _ = nextScheduledRotation(first, marks, loc, dstShift, dstFirst)
+	equals(tomorrow, next, t)
+
+	next, _ = nextScheduledRotation(now, marks, loc, dstShift, dstLast)
+	equals(second, next.UTC(), t)
+	next, _ = nextScheduledRotation(second, marks, loc, dstShift, dstLast)
+	equals(tomorrow, next, t)
+
+	next, _ = nextScheduledRotation(now, marks, loc, dstShift, dstBoth)
+	equals(first, next.UTC(), t)
+	next, _ = nextScheduledRotation(first, marks, loc, dstShift, dstBoth)
+	equals(second, next.UTC(), t)
+	next, _ = nextScheduledRotation(second, marks, loc, dstShift, dstBoth)
+	equals(tomorrow, next, t)
+}
+
+func TestDueScheduledMark_DST(t *testing.T) {
+	loc := loadDSTZone(t)
+	marks := []rotateAt{{2, 30}}
+
+	// Spring forward: a write at 03:10 CEST catches up the shifted mark once.
+	last := time.Date(2025, 3, 30, 0, 0, 0, 0, loc)
+	now := time.Date(2025, 3, 30, 3, 10, 0, 0, loc)
+	mark, due := dueScheduledMark(last, now, marks, loc, dstShift, dstFirst)
+	assert(due, t, "expected shifted mark to be due")
+	equals(time.Date(2025, 3, 30, 3, 0, 0, 0, loc), mark, t)
+	_, due = dueScheduledMark(mark, now, marks, loc, dstShift, dstFirst)
+	assert(!due, t, "expected no second rotation")
+	_, due = dueScheduledMark(last, now, marks, loc, dstSkip, dstFirst)
+	assert(!due, t, "expected skipped mark not to be due")
+
+	// Fall back: after the first 02:30 fired, the repeated 02:30 only fires with "both".
+	first := time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC)
+	now = time.Date(2025, 10, 26, 1, 45, 0, 0, time.UTC) // 02:45 CET
+	_, due = dueScheduledMark(first, now, marks, loc, dstShift, dstFirst)
+	assert(!due, t, "expected mark to fire once")
+	mark, due = dueScheduledMark(first, now, marks, loc, dstShift, dstBoth)
+	assert(due, t, "expected second occurrence to be due")
+	equals(time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC), mark.UTC(), t)
+}
+
+func TestEnsureScheduledRotationLoopRunning_InvalidDSTPolicy(t *testing.T) {
+	l := &Logger{
+		RotateAt:         []string{"02:30"},
+		DSTGapPolicy:     "SKIP",
+		DSTOverlapPolicy: "sometimes",
+	}
+	l.ensureScheduledRotationLoopRunning()
+	defer l.Close()
+
+	equals(dstSkip, l.dstGapPolicy, t)
+	equals(dstFirst, l.dstOverlapPolicy, t)
+}
+
+func TestTimeZone_BackupNamesAndParsing(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	now := time.Date(2025, 5, 1, 22, 30, 0, 0, time.UTC) // 00:30 on May 2nd in Berlin
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	l := &Logger{
+		Filename:            filepath.Join(dir, "app.log"),
+		TimeZone:            "Europe/Berlin",
+		BackupDir:           "archive",
+		BackupDirTimeFormat: "2006-01-02",
+	}
+	defer l.Close()
+
+	writeOnce(t, l, "hello\n")
+	isNil(l.Rotate(), t)
+
+	exists(filepath.Join(dir, "archive", "2025-05-02", "app-2025-05-02T00-30-00.000-size.log"), t)
+
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(1, len(files), t)
+	assert(files[0].timestamp.Equal(now), t, "expected parsed timestamp %v, got %v", now, files[0].timestamp)
+}
+
+func TestLocation_ScheduledCatchUp(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	now := time.Date(2025, 5, 1, 21, 59, 0, 0, time.UTC) // 23:59 in Berlin
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	l := &Logger{
+		Filename: filepath.Join(dir, "app.log"),
+		Location: loadDSTZone(t),
+		TimeZone: "America/New_York", // Location wins
+		RotateAt: []string{"00:00"},
+	}
+	defer l.Close()
+
+	writeOnce(t, l, "before midnight\n")
+	now = now.Add(2 * time.Minute) // 00:01 in Berlin, still May 1st in UTC
+	writeOnce(t, l, "after midnight\n")
+
+	existsWithContent(filepath.Join(dir, "app-2025-05-02T00-01-00.000-time.log"), []byte("before midnight\n"), t)
+	existsWithContent(l.Filename, []byte("after midnight\n"), t)
+}
+
+func TestTimeZone_InvalidFallsBackToLocalTime(t *testing.T) {
+	l := &Logger{TimeZone: "Not/AZone"}
+	equals(time.UTC, l.location(), t)
+
+	l = &Logger{TimeZone: "Not/AZone", LocalTime: true}
+	equals(time.Local, l.location(), t)
+}
+
+func TestSyncPolicy(t *testing.T) {
+	oldNow, oldSync := currentTime, fileSync
+	defer func() { currentTime, fileSync = oldNow, oldSync }()
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+	syncs := 0
+	fileSync = func(f *os.File) error {
+		syncs++
+		return f.Sync()
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		bytes    int64
+		interval time.Duration
+		step     time.Duration
+		syncs    int // after five 4-byte writes, one per step
+	}{
+		{"none", "", 0, 0, 0, 0},
+		{"write", "write", 0, 0, 0, 5},
+		{"bytes", "bytes", 8, 0, 0, 2},
+		{"interval", "interval", 0, time.Minute, 30 * time.Second, 2},
+		{"rotate", "rotate", 0, 0, 0, 0},
+		{"invalid", "always", 0, 0, 0, 0},
+		{"bytes without SyncEveryBytes", "bytes", 0, 0, 0, 0},      // 1 MiB
+		{"interval without SyncInterval", "interval", 0, -1, 0, 0}, // 1s
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syncs = 0
+			l := &Logger{
+				Filename:       logFile(mktempDir(t)),
+				SyncPolicy:     tt.policy,
+				SyncEveryBytes: tt.bytes,
+				SyncInterval:   tt.interval,
+			}
+			for i := 0; i < 5; i++ {
+				writeOnce(t, l, "abc\n")
+				now = now.Add(tt.step)
+			}
+			equals(tt.syncs, syncs, t)
+			isNil(l.Close(), t)
+		})
+	}
+}
+
+func TestSyncPolicy_IntervalTimer(t *testing.T) {
+	oldNow, oldSync := currentTime, fileSync
+	defer func() { currentTime, fileSync = oldNow, oldSync }()
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	currentTime = func() time.Time { return now }
+	syncs := 0
+	fileSync = func(f *os.File) error {
+		syncs++
+		return f.Sync()
+	}
+
+	l := &Logger{Filename: logFile(mktempDir(t)), SyncPolicy: "interval", SyncInterval: time.Hour}
+	defer l.Close()
+	writeOnce(t, l, "a\n")
+	assert(l.syncArmed, t, "expected a pending sync")
+
+	// The timer fires early (as seen by the clock): it's re-armed.
+	now = start.Add(30 * time.Minute)
+	l.syncIfDue()
+	equals(0, syncs, t)
+	assert(l.syncArmed, t, "expected the sync to be re-armed")
+
+	// No write came along: the timer syncs.
+	now = start.Add(time.Hour)
+	l.syncIfDue()
+	equals(1, syncs, t)
+	assert(!l.syncArmed, t, "expected the timer to wait for the next write")
+
+	// Nothing to sync.
+	now = start.Add(3 * time.Hour)
+	l.syncIfDue()
+	equals(1, syncs, t)
+}
+
+func TestSyncPolicy_Rotate(t *testing.T) {
+	oldSync := fileSync
+	defer func() { fileSync = oldSync }()
+	var synced []string
+	fileSync = func(f *os.File) error {
+		synced = append(synced, filepath.Base(f.Name()))
+		return f.Sync()
+	}
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), SyncPolicy: "rotate"}
+	writeOnce(t, l, "before\n")
+	isNil(l.Rotate(), t)
+	equals([]string{"foobar.log"}, synced, t)
+
+	writeOnce(t, l, "after\n")
+	isNil(l.Close(), t)
+	equals([]string{"foobar.log", "foobar.log"}, synced, t) // Close syncs too
+	existsWithContent(l.Filename, []byte("after\n"), t)
+}
+
+func TestSync(t *testing.T) {
+	l := &Logger{Filename: logFile(mktempDir(t))}
+	defer l.Close()
+	isNil(l.Sync(), t) // nothing open yet
+
+	writeOnce(t, l, "data\n")
+	isNil(l.Sync(), t)
+
+	oldSync := fileSync
+	defer func() { fileSync = oldSync }()
+	fileSync = func(*os.File) error { return fmt.Errorf("mock sync failure") }
+	notNil(l.Sync(), t)
+}
+
+func TestCompressLogFile_NoTempLeftBehind(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foobar-2025-05-01T10-00-00.000-size.log")
+	isNil(os.WriteFile(src, []byte("payload"), 0644), t)
+
+	isNil(compressLogFile(src, src+zstdSuffix), t)
+
+	notExist(src, t)
+	notExist(compressTempName(src+zstdSuffix), t)
+	isNil(validateArchive(src+zstdSuffix, nil), t)
+	equals("payload", string(readZstdFile(t, src+zstdSuffix)), t)
+	fileCount(dir, 1, t)
+}
+
+func TestCompressLogFile_RenameFailsKeepsSource(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foobar-2025-05-01T10-00-00.000-size.log")
+	isNil(os.WriteFile(src, []byte("payload"), 0644), t)
+
+	originalRename := osRename
+	osRename = func(_, _ string) error { return fmt.Errorf("mock rename failure") }
+	defer func() { osRename = originalRename }()
+
+	err := compressLogFile(src, src+compressSuffix)
+	notNil(err, t)
+	existsWithContent(src, []byte("payload"), t)
+	fileCount(dir, 1, t) // neither the archive nor its temp file
+}
+
+func TestMillRunOnce_RecoversInterruptedCompression(t *testing.T) {
+	dir := t.TempDir()
+	l := &Logger{Filename: filepath.Join(dir, "foobar.log")}
+	defer l.Close()
+
+	name := func(minute int) string {
+		return filepath.Join(dir, fmt.Sprintf("foobar-2025-05-01T10-%02d-00.000-size.log", minute))
+	}
+
+	// A crash while writing the temp file.
+	temp := compressTempName(name(1) + compressSuffix)
+	isNil(os.WriteFile(temp, []byte("partial"), 0644), t)
+	isNil(os.WriteFile(name(1), []byte("one"), 0644), t)
+
+	// A crash while writing the archive in place (older versions): the
+	// archive is truncated and must go, the source stays.
+	isNil(os.WriteFile(name(2), []byte("two"), 0644), t)
+	isNil(compressLogFile(name(2), name(2)+compressSuffix), t)
+	isNil(os.WriteFile(name(2), []byte("two"), 0644), t)
+	gz, err := os.ReadFile(name(2) + compressSuffix)
+	isNil(err, t)
+	isNil(os.WriteFile(name(2)+compressSuffix, gz[:len(gz)-4], 0644), t)
+
+	// A crash after the archive was complete but before the source was removed.
+	isNil(os.WriteFile(name(3), []byte("three"), 0644), t)
+	isNil(compressLogFile(name(3), name(3)+zstdSuffix), t)
+	isNil(os.WriteFile(name(3), []byte("three"), 0644), t)
+
+	// Hidden files that aren't ours are left alone.
+	other := filepath.Join(dir, ".other.gz.tmp")
+	isNil(os.WriteFile(other, []byte("x"), 0644), t)
+
+	isNil(l.millRunOnce(), t)
+
+	notExist(temp, t)
+	existsWithContent(name(1), []byte("one"), t)
+	existsWithContent(name(2), []byte("two"), t)
+	notExist(name(2)+compressSuffix, t)
+	notExist(name(3), t)
+	equals("three", string(readZstdFile(t, name(3)+zstdSuffix)), t)
+	exists(other, t)
+}
+
+func TestMillRunOnce_VerifiesOrphanArchives(t *testing.T) {
+	name := func(dir string, minute int) string {
+		return filepath.Join(dir, fmt.Sprintf("foobar-2025-05-01T10-%02d-00.000-size.log", minute))
+	}
+	archive := func(dir string, minute int, content string) string {
+		isNil(os.WriteFile(name(dir, minute), []byte(content), 0644), t)
+		isNil(compressLogFile(name(dir, minute), name(dir, minute)+compressSuffix), t)
+		return name(dir, minute) + compressSuffix
+	}
+	truncate := func(path string) {
+		gz, err := os.ReadFile(path)
+		isNil(err, t)
+		isNil(os.WriteFile(path, gz[:len(gz)-4], 0644), t)
+	}
+
+	// The newest archive was cut short after its source was removed: it is
+	// moved aside, the older ones are kept.
+	dir := t.TempDir()
+	l := &Logger{Filename: filepath.Join(dir, "foobar.log")}
+	defer l.Close()
+	old := archive(dir, 1, "one")
+	last := archive(dir, 2, "two")
+	truncate(last)
+	isNil(os.Chtimes(old, time.Now(), time.Now().Add(-time.Minute)), t)
+	isNil(l.millRunOnce(), t)
+	exists(old, t)
+	notExist(last, t)
+	exists(last+corruptSuffix, t)
+
+	// Temp files whose source and archive are both gone are the only copy:
+	// a complete one is kept, an incomplete one is moved aside.
+	dir = t.TempDir()
+	l = &Logger{Filename: filepath.Join(dir, "foobar.log"), Manifest: true}
+	defer l.Close()
+	complete := archive(dir, 1, "one")
+	isNil(os.Rename(complete, compressTempName(complete)), t)
+	partial := archive(dir, 2, "two")
+	truncate(partial)
+	isNil(os.Rename(partial, compressTempName(partial)), t)
+	isNil(l.millRunOnce(), t)
+	notExist(compressTempName(complete), t)
+	exists(complete, t)
+	notExist(compressTempName(partial), t)
+	notExist(partial, t)
+	exists(partial+corruptSuffix, t)
+	entries := readManifestEntries(t, l)
+	equals(1, len(entries), t)
+	equals(filepath.Base(complete), entries[0].Name, t)
+}
+
+func TestCompressLogFileVerified(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foobar-2025-05-01T10-00-00.000-size.log")
+	isNil(os.WriteFile(src, []byte(strings.Repeat("payload\n", 100)), 0644), t)
+
+	isNil(archiveLogFile(src, src+compressSuffix, archiveOptions{verify: true, uid: -1, gid: -1}), t)
+	notExist(src, t)
+	isNil(validateArchive(src+compressSuffix, nil), t)
+}
+
+func TestCompressLogFileVerified_CorruptArchiveKeepsSource(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foobar-2025-05-01T10-00-00.000-size.log")
+	content := []byte(strings.Repeat("payload\n", 100))
+	isNil(os.WriteFile(src, content, 0644), t)
+
+	// Corrupt the archive after it's written, just before it's synced.
+	oldSync := fileSync
+	defer func() { fileSync = oldSync }()
+	fileSync = func(f *os.File) error {
+		if err := f.Truncate(20); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+
+	err := archiveLogFile(src, src+zstdSuffix, archiveOptions{verify: true, uid: -1, gid: -1})
+	var verr *VerifyError
+	assert(errors.As(err, &verr), t, "expected *VerifyError, got %v", err)
+	equals(src+zstdSuffix, verr.Name, t)
+	existsWithContent(src, content, t)
+	fileCount(dir, 1, t)
+}
+
+func TestVerifyBackups(t *testing.T) {
+	dir := t.TempDir()
+	l := &Logger{Filename: filepath.Join(dir, "foobar.log")}
+	defer l.Close()
+
+	good := filepath.Join(dir, "foobar-2025-05-01T10-00-00.000-size.log")
+	bad := filepath.Join(dir, "foobar-2025-05-01T11-00-00.000-size.log")
+	plain := filepath.Join(dir, "foobar-2025-05-01T12-00-00.000-size.log")
+	for _, name := range []string{good, bad, plain} {
+		isNil(os.WriteFile(name, []byte("some log data\n"), 0644), t)
+	}
+	isNil(compressLogFile(good, good+compressSuffix), t)
+	isNil(compressLogFile(bad, bad+zstdSuffix), t)
+	zst, err := os.ReadFile(bad + zstdSuffix)
+	isNil(err, t)
+	isNil(os.WriteFile(bad+zstdSuffix, zst[:len(zst)-3], 0644), t)
+
+	failed, err := l.VerifyBackups()
+	isNil(err, t)
+	equals(1, len(failed), t)
+	equals(bad+zstdSuffix, failed[0].Name, t)
+	assert(strings.Contains(failed[0].Error(), "failed verification"), t, "unexpected error: %v", failed[0])
+}
+
+func readManifestEntries(t *testing.T, l *Logger) []ManifestEntry {
+	t.Helper()
+	b, err := os.ReadFile(l.manifestPath())
+	isNil(err, t)
+	var entries []ManifestEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e ManifestEntry
+		isNil(json.Unmarshal([]byte(line), &e), t)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestManifest_Rotations(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), Manifest: true}
+	defer l.Close()
+
+	start := fakeTime()
+	writeOnce(t, l, "first\n")
+	newFakeTime()
+	isNil(l.RotateWithReason("deploy"), t)
+	first := backupFileWithReason(dir, "deploy")
+	writeOnce(t, l, "second\n")
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	second := backupFileWithReason(dir, "size")
+
+	entries := readManifestEntries(t, l)
+	equals(2, len(entries), t)
+	e := entries[0]
+	equals("rotate", e.Event, t)
+	equals(filepath.Base(first), e.Name, t)
+	equals("deploy", e.Reason, t)
+	assert(e.Start.Equal(start), t, "expected start %v, got %v", start, e.Start)
+	assert(e.End.Equal(fakeTime().Add(-48*time.Hour)), t, "unexpected end %v", e.End)
+	equals(int64(len("first\n")), e.Size, t)
+	sum := sha256.Sum256([]byte("first\n"))
+	equals(hex.EncodeToString(sum[:]), e.SHA256, t)
+	equals("none", e.Compression, t)
+	equals(filepath.Base(second), entries[1].Name, t)
+
+	failed, err := l.VerifyManifest()
+	isNil(err, t)
+	equals(0, len(failed), t)
+
+	// Tamper with the backups.
+	isNil(os.WriteFile(first, []byte("FIRST\n"), 0644), t)
+	isNil(os.Remove(second), t)
+	unlisted := filepath.Join(dir, "foobar-2001-01-01T00-00-00.000-size.log")
+	isNil(os.WriteFile(unlisted, []byte("x"), 0644), t)
+
+	failed, err = l.VerifyManifest()
+	isNil(err, t)
+	equals(3, len(failed), t)
+	got := make(map[string]error)
+	for _, f := range failed {
+		got[f.Name] = f.Err
+	}
+	equals(ErrChecksumMismatch, got[first], t)
+	equals(ErrBackupMissing, got[second], t)
+	equals(ErrNotInManifest, got[unlisted], t)
+}
+
+func TestManifest_MillCompressAndRemove(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), Manifest: true}
+	var backups []string
+	for i := 0; i < 3; i++ {
+		writeOnce(t, l, fmt.Sprintf("segment %d\n", i))
+		newFakeTime()
+		isNil(l.Rotate(), t)
+		backups = append(backups, backupFileWithReason(dir, "size"))
+	}
+	isNil(l.Shutdown(context.Background()), t) // wait for its mill
+
+	// A fresh Logger for the same file runs the mill deterministically.
+	m := &Logger{Filename: logFile(dir), Manifest: true, Compression: "gzip", MaxBackups: 2}
+	defer m.Close()
+	isNil(m.millRunOnce(), t)
+
+	notExist(backups[0], t)
+	exists(backups[1]+compressSuffix, t)
+	exists(backups[2]+compressSuffix, t)
+
+	entries := readManifestEntries(t, m)
+	equals(6, len(entries), t) // 3 rotations, 1 removal, 2 compressions
+	equals("remove", entries[3].Event, t)
+	equals(filepath.Base(backups[0]), entries[3].Name, t)
+	rotated := make(map[string]ManifestEntry)
+	for _, e := range entries[:3] {
+		rotated[e.Name] = e
+	}
+	for _, e := range entries[4:] {
+		equals("compress", e.Event, t)
+		equals("gzip", e.Compression, t)
+		equals(strings.TrimSuffix(e.Name, compressSuffix), e.Source, t)
+		// The segment's start and reason are carried forward.
+		equals("size", e.Reason, t)
+		assert(!e.Start.IsZero(), t, "expected the start of %s", e.Name)
+		assert(e.Start.Equal(rotated[e.Source].Start), t, "expected start %v, got %v", rotated[e.Source].Start, e.Start)
+	}
+
+	failed, err := m.VerifyManifest()
+	isNil(err, t)
+	equals(0, len(failed), t)
+}
+
+func TestManifest_ReopenedFile(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	isNil(os.WriteFile(logFile(dir), []byte("old\n"), 0644), t)
+
+	// The reopened file is checksummed by the mill, after the rotation; the
+	// next rotation is recorded after it.
+	l := &Logger{Filename: logFile(dir), Manifest: true, HashChain: true}
+	writeOnce(t, l, "new\n")
+	newFakeTime()
+	isNil(l.RotateWithReason("first"), t)
+	writeOnce(t, l, "second\n")
+	newFakeTime()
+	isNil(l.RotateWithReason("second"), t)
+	isNil(l.Shutdown(context.Background()), t) // wait for its mill
+
+	entries := readManifestEntries(t, l)
+	equals(2, len(entries), t)
+	equals("first", entries[0].Reason, t)
+	sum := sha256.Sum256([]byte("old\nnew\n"))
+	equals(hex.EncodeToString(sum[:]), entries[0].SHA256, t)
+	equals("second", entries[1].Reason, t)
+
+	failed, err := l.VerifyManifest()
+	isNil(err, t)
+	equals(0, len(failed), t)
+	failed, err = l.VerifyChain(nil)
+	isNil(err, t)
+	equals(0, len(failed), t)
+}
+
+func TestHashChain(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	isNil(err, t)
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), HashChain: true, ChainSigningKey: priv}
+	var backups []string
+	for i := 0; i < 4; i++ {
+		writeOnce(t, l, fmt.Sprintf("segment %d\n", i))
+		newFakeTime()
+		isNil(l.Rotate(), t)
+		backups = append(backups, backupFileWithReason(dir, "size"))
+	}
+	isNil(l.Shutdown(context.Background()), t) // wait for its mill
+
+	failed, err := l.VerifyChain(pub)
+	isNil(err, t)
+	equals(0, len(failed), t)
+
+	// Retention and compression by the mill keep the chain intact; a new
+	// Logger picks up the chain where the old one left off.
+	m := &Logger{Filename: logFile(dir), HashChain: true, ChainSigningKey: priv, Compression: "zstd", MaxBackups: 3}
+	defer m.Close()
+	isNil(m.millRunOnce(), t)
+	notExist(backups[0], t)
+
+	links, err := m.readChain()
+	isNil(err, t)
+	equals(5, len(links), t)
+	equals("prune", links[4].Event, t)
+	equals(filepath.Base(backups[0]), links[4].Name, t)
+
+	failed, err = m.VerifyChain(pub)
+	isNil(err, t)
+	equals(0, len(failed), t)
+
+	// A different key doesn't verify.
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	isNil(err, t)
+	failed, err = m.VerifyChain(otherPub)
+	isNil(err, t)
+	equals(5, len(failed), t)
+	assert(errors.Is(failed[0].Err, ErrBadSignature), t, "expected bad signature, got %v", failed[0].Err)
+
+	// Removing a middle backup is detected.
+	isNil(os.Remove(backups[2]+zstdSuffix), t)
+	failed, err = m.VerifyChain(pub)
+	isNil(err, t)
+	equals(1, len(failed), t)
+	equals(ErrBackupMissing, failed[0].Err, t)
+}
+
+func TestHashChain_TamperedLinks(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), HashChain: true}
+	defer l.Close()
+	for i := 0; i < 3; i++ {
+		writeOnce(t, l, fmt.Sprintf("segment %d\n", i))
+		newFakeTime()
+		isNil(l.Rotate(), t)
+	}
+
+	// Drop the middle link, as someone hiding a backup would.
+	b, err := os.ReadFile(l.chainPath())
+	isNil(err, t)
+	lines := strings.SplitAfter(string(b), "\n")
+	isNil(os.WriteFile(l.chainPath(), []byte(lines[0]+lines[2]), 0644), t)
+
+	failed, err := l.VerifyChain(nil)
+	isNil(err, t)
+	equals(1, len(failed), t)
+	assert(errors.Is(failed[0].Err, ErrChainBroken), t, "expected broken chain, got %v", failed[0].Err)
+
+	// Editing a recorded checksum breaks the link's digest.
+	edited := strings.Replace(lines[1], `"sha256":"`, `"sha256":"0`, 1)
+	isNil(os.WriteFile(l.chainPath(), []byte(lines[0]+edited+lines[2]), 0644), t)
+	failed, err = l.VerifyChain(nil)
+	isNil(err, t)
+	assert(len(failed) > 0 && errors.Is(failed[0].Err, ErrChainBroken), t, "expected broken chain, got %v", failed)
+}
+
+func testKeys(t *testing.T) StaticKeys {
+	t.Helper()
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": key}}
+}
+
+func encryptBytes(t *testing.T, keys KeyProvider, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newEncryptWriter(&buf, keys)
+	isNil(err, t)
+	_, err = w.Write(plain)
+	isNil(err, t)
+	isNil(w.Close(), t)
+	return buf.Bytes()
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	keys := testKeys(t)
+	for _, size := range []int{0, 1, encChunkSize - 1, encChunkSize, 3*encChunkSize + 17} {
+		plain := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+		r, err := NewDecryptReader(bytes.NewReader(encryptBytes(t, keys, plain)), keys)
+		isNil(err, t)
+		got, err := io.ReadAll(r)
+		isNil(err, t)
+		assert(bytes.Equal(plain, got), t, "size %d: round trip mismatch", size)
+	}
+}
+
+func TestDecryptReader_DetectsTampering(t *testing.T) {
+	keys := testKeys(t)
+	plain := bytes.Repeat([]byte("x"), 2*encChunkSize+5)
+	sealed := encryptBytes(t, keys, plain)
+	header := len(encMagic) + 1 + len("k1") + encNoncePrefixSize
+	chunk := encChunkSize + 16
+
+	flipped := bytes.Clone(sealed)
+	flipped[header+chunk+10] ^= 1
+	truncated := sealed[:header+2*chunk] // drop the last chunk
+	dropped := append(bytes.Clone(sealed[:header+chunk]), sealed[header+2*chunk:]...)
+
+	for name, data := range map[string][]byte{"flipped": flipped, "truncated": truncated, "dropped": dropped} {
+		r, err := NewDecryptReader(bytes.NewReader(data), keys)
+		isNil(err, t)
+		_, err = io.ReadAll(r)
+		assert(errors.Is(err, ErrDecrypt), t, "%s: expected ErrDecrypt, got %v", name, err)
+	}
+
+	other := StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": make([]byte, 32)}}
+	r, err := NewDecryptReader(bytes.NewReader(sealed), other)
+	isNil(err, t)
+	_, err = io.ReadAll(r)
+	assert(errors.Is(err, ErrDecrypt), t, "wrong key: expected ErrDecrypt, got %v", err)
+
+	_, err = NewDecryptReader(bytes.NewReader(sealed), StaticKeys{})
+	notNil(err, t)
+}
+
+func TestMill_EncryptsBackups(t *testing.T) {
+	keys := testKeys(t)
+	for _, tc := range []struct {
+		compression, suffix string
+	}{
+		{"gzip", ".gz.enc"},
+		{"zstd", ".zst.enc"},
+		{"none", ".enc"},
+	} {
+		t.Run(tc.compression, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "foobar-2025-05-01T10-00-00.000-size.log")
+			isNil(os.WriteFile(src, []byte("secret\n"), 0644), t)
+
+			l := &Logger{Filename: filepath.Join(dir, "foobar.log"), Compression: tc.compression, KeyProvider: keys, VerifyCompression: true}
+			defer l.Close()
+			isNil(l.millRunOnce(), t)
+
+			notExist(src, t)
+			files, err := l.oldLogFiles()
+			isNil(err, t)
+			equals(1, len(files), t)
+			equals(filepath.Base(src)+tc.suffix, files[0].Name(), t)
+
+			raw, err := os.ReadFile(src + tc.suffix)
+			isNil(err, t)
+			assert(!bytes.Contains(raw, []byte("secret")), t, "backup isn't encrypted")
+
+			r, err := OpenBackup(src+tc.suffix, keys)
+			isNil(err, t)
+			got, err := io.ReadAll(r)
+			isNil(err, t)
+			isNil(r.Close(), t)
+			equals("secret\n", string(got), t)
+
+			failed, err := l.VerifyBackups()
+			isNil(err, t)
+			equals(0, len(failed), t)
+		})
+	}
+}
+
+func TestHeaderAndFooter(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	var headers, footers []SegmentInfo
+	l := &Logger{
+		Filename: logFile(dir),
+		Header: func(info SegmentInfo) []byte {
+			headers = append(headers, info)
+			return []byte(fmt.Sprintf("# start=%s previous=%s\n", info.Start.UTC().Format(time.RFC3339), filepath.Base(info.Previous)))
+		},
+		Footer: func(info SegmentInfo) []byte {
+			footers = append(footers, info)
+			return []byte(fmt.Sprintf("# end size=%d\n", info.Size))
+		},
+	}
+	defer l.Close()
+
+	start := fakeTime()
+	writeOnce(t, l, "one\n")
+	header := fmt.Sprintf("# start=%s previous=.\n", start.UTC().Format(time.RFC3339))
+	equals(int64(len(header)+len("one\n")), l.size, t)
+
+	newFakeTime()
+	isNil(l.RotateWithReason("deploy"), t)
+	backup := backupFileWithReason(dir, "deploy")
+
+	// The footer counts the header, and is counted itself.
+	footer := fmt.Sprintf("# end size=%d\n", len(header)+len("one\n"))
+	existsWithContent(backup, []byte(header+"one\n"+footer), t)
+	equals(1, len(footers), t)
+	equals("deploy", footers[0].Reason, t)
+	assert(footers[0].Start.Equal(start), t, "unexpected footer start %v", footers[0].Start)
+	assert(footers[0].End.Equal(fakeTime()), t, "unexpected footer end %v", footers[0].End)
+
+	equals(2, len(headers), t)
+	equals("initial", headers[0].Reason, t)
+	equals("", headers[0].Previous, t)
+	equals("deploy", headers[1].Reason, t)
+	equals(backup, headers[1].Previous, t)
+	assert(headers[1].Start.Equal(fakeTime()), t, "unexpected header start %v", headers[1].Start)
+
+	header2 := fmt.Sprintf("# start=%s previous=%s\n", fakeTime().UTC().Format(time.RFC3339), filepath.Base(backup))
+	existsWithContent(l.Filename, []byte(header2), t)
+	equals(int64(len(header2)), l.size, t)
+}
+
+func TestFooter_RotationFails(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	footers := 0
+	l := &Logger{
+		Filename: logFile(dir),
+		Footer: func(SegmentInfo) []byte {
+			footers++
+			return []byte("# end\n")
+		},
+	}
+	defer l.Close()
+	writeOnce(t, l, "one\n")
+
+	// openNew fails to move the file aside: it stays live, with its footer.
+	osRename = func(string, string) error { return errors.New("rename failed") }
+	newFakeTime()
+	notNil(l.RotateWithReason("deploy"), t)
+	osRename = os.Rename
+	existsWithContent(l.Filename, []byte("one\n# end\n"), t)
+
+	// The next write finishes the rotation first, without a second footer.
+	writeOnce(t, l, "two\n")
+	equals(1, footers, t)
+	existsWithContent(backupFileWithReason(dir, "deploy"), []byte("one\n# end\n"), t)
+	existsWithContent(l.Filename, []byte("two\n"), t)
+}
+
+func TestRotateOnClose_NoNewFile(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	headers := 0
+	l := &Logger{
+		Filename:      logFile(dir),
+		RotateOnClose: true,
+		Header: func(SegmentInfo) []byte {
+			headers++
+			return []byte("HDR\n")
+		},
+		Footer: func(SegmentInfo) []byte { return []byte("FTR\n") },
+	}
+	writeOnce(t, l, "one\n")
+	newFakeTime()
+	isNil(l.Close(), t)
+
+	// The segment was moved aside, and no header-only file was started.
+	equals(1, headers, t)
+	existsWithContent(backupFileWithReason(dir, "closing"), []byte("HDR\none\nFTR\n"), t)
+	_, err := os.Stat(l.Filename)
+	assert(os.IsNotExist(err), t, "expected no live file after Close, got %v", err)
+	fileCount(dir, 1, t)
+}
+
+func TestHeader_NotWrittenOnReopen(t *testing.T) {
+	dir := mktempDir(t)
+	filename := logFile(dir)
+	isNil(os.WriteFile(filename, []byte("existing\n"), 0644), t)
+
+	calls := 0
+	l := &Logger{Filename: filename, Header: func(SegmentInfo) []byte {
+		calls++
+		return []byte("header\n")
+	}}
+	defer l.Close()
+	writeOnce(t, l, "more\n")
+
+	equals(0, calls, t)
+	existsWithContent(filename, []byte("existing\nmore\n"), t)
+}
+
+func TestFallbackWriter(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	// A file where the log directory should be makes every open fail.
+	blocker := filepath.Join(dir, "logs")
+	isNil(os.WriteFile(blocker, nil, 0644), t)
+
+	var fallback bytes.Buffer
+	var events []OutageStats
+	l := &Logger{
+		Filename:        filepath.Join(blocker, "foobar.log"),
+		FallbackWriter:  &fallback,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: 3 * time.Second,
+		OutageCallback:  func(s OutageStats) { events = append(events, s) },
+	}
+	defer l.Close()
+
+	writeAt := func(offset time.Duration, data string) {
+		t.Helper()
+		now = start.Add(offset)
+		n, err := l.Write([]byte(data))
+		isNil(err, t)
+		equals(len(data), n, t)
+	}
+
+	writeAt(0, "one\n") // fails, starts the outage
+	equals(1, len(events), t)
+	assert(events[0].Active, t, "expected an active outage")
+	notNil(events[0].Err, t)
+	equals(int64(4), events[0].DivertedBytes, t)
+
+	writeAt(500*time.Millisecond, "two\n") // within the backoff, not retried
+	equals(0, l.Outage().Retries, t)
+	writeAt(time.Second, "three\n")  // retry fails, backoff 2s
+	writeAt(3*time.Second, "four\n") // retry fails, backoff capped at 3s
+	equals(2, l.Outage().Retries, t)
+	equals(start.Add(6*time.Second), l.outageRetryAt, t)
+
+	isNil(os.Remove(blocker), t)     // the volume is back
+	writeAt(5*time.Second, "five\n") // still within the backoff
+	writeAt(6*time.Second, "six\n")  // retry succeeds
+
+	equals("one\ntwo\nthree\nfour\nfive\n", fallback.String(), t)
+	existsWithContent(l.Filename, []byte("six\n"), t)
+
+	equals(2, len(events), t)
+	stats := l.Outage()
+	equals(stats, events[1], t)
+	assert(!stats.Active, t, "expected the outage to be over")
+	equals(start, stats.Start, t)
+	equals(start.Add(6*time.Second), stats.End, t)
+	equals(int64(24), stats.DivertedBytes, t)
+	equals(int64(0), stats.LostBytes, t)
+
+	writeAt(7*time.Second, "seven\n")
+	existsWithContent(l.Filename, []byte("six\nseven\n"), t)
+	equals(2, len(events), t)
+}
+
+func TestFallbackWriter_SyncFails(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	currentTime = func() time.Time { return now }
+	defer func() { fileSync = (*os.File).Sync }()
+
+	dir := mktempDir(t)
+	var fallback bytes.Buffer
+	l := &Logger{
+		Filename:       logFile(dir),
+		SyncPolicy:     "write",
+		FallbackWriter: &fallback,
+		RetryBackoff:   time.Second,
+	}
+	defer l.Close()
+
+	// The bytes are written, but not synced: the outage starts, and nothing is diverted.
+	fileSync = func(*os.File) error { return errors.New("sync failed") }
+	n, err := l.Write([]byte("one\n"))
+	notNil(err, t)
+	equals(4, n, t)
+	assert(l.Outage().Active, t, "expected an active outage")
+	equals(0, fallback.Len(), t)
+
+	fileSync = (*os.File).Sync
+	now = start.Add(time.Second)
+	writeOnce(t, l, "two\n")
+	assert(!l.Outage().Active, t, "expected the outage to be over")
+	existsWithContent(l.Filename, []byte("one\ntwo\n"), t)
+}
+
+func TestFallbackWriter_RotationFails(t *testing.T) {
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+
+	dir := mktempDir(t)
+	var fallback bytes.Buffer
+	l := &Logger{Filename: logFile(dir), MaxSize: 10, FallbackWriter: &fallback}
+	defer l.Close()
+	writeOnce(t, l, "12345678")
+
+	// The file can't be renamed, but it is fine: the error is returned, and
+	// the next write tries again.
+	osRename = func(string, string) error { return errors.New("rename failed") }
+	defer func() { osRename = os.Rename }()
+	_, err := l.Write([]byte("abcd"))
+	notNil(err, t)
+	assert(!l.Outage().Active, t, "expected no outage")
+	equals(0, fallback.Len(), t)
+
+	osRename = os.Rename
+	writeOnce(t, l, "abcd")
+	existsWithContent(l.Filename, []byte("abcd"), t)
+	fileCount(dir, 2, t)
+}
+
+func TestFallbackWriter_ConfigurationError(t *testing.T) {
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+
+	dir := mktempDir(t)
+	blocker := filepath.Join(dir, "backups")
+	isNil(os.WriteFile(blocker, nil, 0644), t)
+
+	// BackupDir can't be created: every rotation fails, but the log file
+	// itself is fine, so writes aren't diverted.
+	var fallback bytes.Buffer
+	l := &Logger{Filename: logFile(dir), MaxSize: 10, BackupDir: filepath.Join(blocker, "old"), FallbackWriter: &fallback}
+	defer l.Close()
+	writeOnce(t, l, "12345678")
+	for i := 0; i < 2; i++ {
+		_, err := l.Write([]byte("abcd"))
+		notNil(err, t)
+		assert(!l.Outage().Active, t, "expected no outage")
+	}
+	equals(0, fallback.Len(), t)
+	existsWithContent(l.Filename, []byte("12345678"), t)
+}
+
+func TestRetryBackoff_NoFallback(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	now := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	blocker := filepath.Join(dir, "logs")
+	isNil(os.WriteFile(blocker, nil, 0644), t)
+
+	l := &Logger{Filename: filepath.Join(blocker, "foobar.log"), RetryBackoff: time.Minute}
+	defer l.Close()
+
+	for i := 0; i < 3; i++ {
+		n, err := l.Write([]byte("boo!"))
+		equals(0, n, t)
+		assert(errors.Is(err, ErrUnavailable), t, "expected ErrUnavailable, got %v", err)
+	}
+	stats := l.Outage()
+	assert(stats.Active, t, "expected an active outage")
+	equals(0, stats.Retries, t)
+	equals(int64(12), stats.LostBytes, t)
+
+	// Oversized writes are rejected as usual, not treated as an outage.
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	l.MaxSize = 10
+	_, err := l.Write(make([]byte, 11))
+	assert(err != nil && !errors.Is(err, ErrUnavailable), t, "expected a size error, got %v", err)
+	equals(int64(12), l.Outage().LostBytes, t)
+}
+
+func TestShutdown_WaitsForMill(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), Compression: "gzip"}
+	writeOnce(t, l, "boo!")
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	backup := backupFileWithReason(dir, "size")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	isNil(l.Shutdown(ctx), t)
+
+	// No waiting: the compression finished before Shutdown returned.
+	notExist(backup, t)
+	exists(backup+compressSuffix, t)
+	isNil(l.Shutdown(ctx), t) // already closed
+}
+
+func TestShutdown_Deadline(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	l := &Logger{
+		Filename:    logFile(dir),
+		Compression: "gzip",
+		Callback: func(string, []string) {
+			select {
+			case entered <- struct{}{}:
+			default:
+			}
+			<-release
+		},
+	}
+	writeOnce(t, l, "one")
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	first := backupFileWithReason(dir, "size")
+	<-entered // the first pass is stuck in Callback
+
+	writeOnce(t, l, "two")
+	newFakeTime()
+	isNil(l.Rotate(), t) // queues a second pass
+	second := backupFileWithReason(dir, "size")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := l.Shutdown(ctx)
+	var serr *ShutdownError
+	assert(errors.As(err, &serr), t, "expected a *ShutdownError, got %v", err)
+	assert(errors.Is(err, context.DeadlineExceeded), t, "expected DeadlineExceeded, got %v", err)
+	equals([]string{second}, serr.Pending, t)
+
+	// The queued pass no longer compresses once Shutdown gave up.
+	close(release)
+	l.millWg.Wait()
+	exists(first+compressSuffix, t)
+	exists(second, t)
+	notExist(second+compressSuffix, t)
+}
+
+func TestManager_SharedMill(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	m := &Manager{MillWorkers: 2}
+	var backups []string
+	var loggers []*Logger
+	for i := 0; i < 5; i++ {
+		dir := mktempDir(t)
+		l := &Logger{Filename: logFile(dir), Compression: "gzip"}
+		isNil(m.Add(l), t)
+		writeOnce(t, l, fmt.Sprintf("tenant %d\n", i))
+		newFakeTime()
+		isNil(l.Rotate(), t)
+		backups = append(backups, backupFileWithReason(dir, "size"))
+		loggers = append(loggers, l)
+	}
+	for _, l := range loggers {
+		assert(l.millCh == nil, t, "expected no mill goroutine of the Logger")
+	}
+	notNil(m.Add(loggers[0]), t) // already added
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	isNil(m.Shutdown(ctx), t)
+	for _, b := range backups {
+		notExist(b, t)
+		exists(b+compressSuffix, t)
+	}
+	for _, l := range loggers {
+		equals(uint32(1), atomic.LoadUint32(&l.isClosed), t)
+	}
+	notNil(m.Add(&Logger{Filename: logFile(mktempDir(t))}), t) // closed
+}
+
+func TestManager_ScheduledRotations(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	var mu sync.Mutex
+	now := time.Date(2025, 5, 12, 10, 0, 59, 900*int(time.Millisecond), time.UTC)
+	currentTime = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	m := &Manager{}
+	defer m.Close()
+	var dirs []string
+	for _, l := range []*Logger{
+		{RotateAt: []string{"10:01"}},
+		{RotateAtMinutes: []int{1}},
+	} {
+		dir := mktempDir(t)
+		dirs = append(dirs, dir)
+		l.Filename = logFile(dir)
+		isNil(m.Add(l), t)
+		writeOnce(t, l, "boo!")
+		assert(l.scheduledRotationQuitCh == nil, t, "expected no scheduler goroutine of the Logger")
+	}
+	nextRotations := func() []time.Time {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		var at []time.Time
+		for _, r := range m.timers {
+			at = append(at, r.at)
+		}
+		sort.Slice(at, func(i, j int) bool { return at[i].Before(at[j]) })
+		return at
+	}
+	mark := time.Date(2025, 5, 12, 10, 1, 0, 0, time.UTC)
+	equals([]time.Time{mark, mark}, nextRotations(), t)
+
+	mu.Lock()
+	now = now.Add(100 * time.Millisecond) // 10:01
+	mu.Unlock()
+	for _, dir := range dirs {
+		_, err := waitForFileWithSuffix(t, dir, "-time.log", 5*time.Second)
+		isNil(err, t)
+	}
+
+	// Both are rescheduled for their next mark.
+	want := []time.Time{mark.Add(time.Hour), mark.AddDate(0, 0, 1)}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && !reflect.DeepEqual(want, nextRotations()) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	equals(want, nextRotations(), t)
+}
+
+func TestManager_IdleTimeout(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	var mu sync.Mutex
+	now := time.Date(2025, 5, 12, 10, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	m := &Manager{}
+	defer m.Close()
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir := mktempDir(t)
+		dirs = append(dirs, dir)
+		l := &Logger{Filename: logFile(dir), IdleTimeout: 100 * time.Millisecond}
+		isNil(m.Add(l), t)
+		writeOnce(t, l, "boo!")
+		assert(l.idleTimer == nil, t, "expected no idle timer of the Logger")
+	}
+	m.mu.Lock()
+	equals(2, len(m.timers), t)
+	for _, r := range m.timers {
+		equals(timerIdle, r.kind, t)
+	}
+	m.mu.Unlock()
+
+	mu.Lock()
+	now = now.Add(100 * time.Millisecond)
+	mu.Unlock()
+	for _, dir := range dirs {
+		_, err := waitForFileWithSuffix(t, dir, "-idle.log", 5*time.Second)
+		isNil(err, t)
+	}
+}
+
+// tenantKey returns the value of the "tenant=" field of a line.
+func tenantKey(p []byte) string {
+	_, rest, _ := strings.Cut(string(p), "tenant=")
+	key, _, _ := strings.Cut(rest, " ")
+	return strings.TrimSpace(key)
+}
+
+func TestRouter_RoutesByKey(t *testing.T) {
+	dir := mktempDir(t)
+	r := &Router{
+		Key:      tenantKey,
+		Filename: filepath.Join(dir, "logs", "{key}.log"),
+		Base: &Logger{
+			Header: func(SegmentInfo) []byte { return []byte("# header\n") },
+		},
+	}
+	defer r.Close()
+
+	for _, line := range []string{"tenant=a one\n", "tenant=b two\n", "tenant=a three\n", "tenant=../x four\n"} {
+		n, err := r.Write([]byte(line))
+		isNil(err, t)
+		equals(len(line), n, t)
+	}
+	existsWithContent(filepath.Join(dir, "logs", "a.log"), []byte("# header\ntenant=a one\ntenant=a three\n"), t)
+	existsWithContent(filepath.Join(dir, "logs", "b.log"), []byte("# header\ntenant=b two\n"), t)
+	existsWithContent(filepath.Join(dir, "logs", ".._x.log"), []byte("# header\ntenant=../x four\n"), t)
+
+	isNil(r.Close(), t)
+	_, err := r.Write([]byte("tenant=a late\n"))
+	notNil(err, t)
+
+	// Without a template, the key is appended to the name of Base.Filename.
+	r2 := &Router{Key: tenantKey, Base: &Logger{Filename: filepath.Join(dir, "app.log")}}
+	defer r2.Close()
+	_, err = r2.Write([]byte("tenant=c five\n"))
+	isNil(err, t)
+	existsWithContent(filepath.Join(dir, "app-c.log"), []byte("tenant=c five\n"), t)
+}
+
+func TestRouter_MaxOpen(t *testing.T) {
+	dir := mktempDir(t)
+	r := &Router{Filename: filepath.Join(dir, "{key}.log"), MaxOpen: 2}
+	defer r.Close()
+
+	write := func(key string) *Logger {
+		t.Helper()
+		_, err := r.WriteKey(key, []byte(key+"\n"))
+		isNil(err, t)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.entries[key].Value.(*routeEntry).l
+	}
+	a := write("a")
+	b := write("b")
+	write("a")
+	write("c") // b is the least recently used
+
+	r.mu.Lock()
+	equals(2, r.lru.Len(), t)
+	_, open := r.entries["b"]
+	r.mu.Unlock()
+	assert(!open, t, "expected b to be evicted")
+	equals(uint32(1), atomic.LoadUint32(&b.isClosed), t)
+	equals(uint32(0), atomic.LoadUint32(&a.isClosed), t)
+
+	// b gets a new Logger, appending to its file; a is evicted now.
+	assert(write("b") != b, t, "expected a new Logger for b")
+	existsWithContent(filepath.Join(dir, "b.log"), []byte("b\nb\n"), t)
+	equals(uint32(1), atomic.LoadUint32(&a.isClosed), t)
+}
+
+func TestRouter_WaitsForEvictedLogger(t *testing.T) {
+	dir := mktempDir(t)
+	r := &Router{Filename: filepath.Join(dir, "{key}.log"), MaxOpen: 1}
+	defer r.Close()
+	_, err := r.WriteKey("a", []byte("a\n"))
+	isNil(err, t)
+
+	// a's Logger is evicted, but not closed yet: its next write waits.
+	r.mu.Lock()
+	evicted := r.remove(r.entries["a"])
+	r.mu.Unlock()
+	done := make(chan error)
+	go func() {
+		_, err := r.WriteKey("a", []byte("b\n"))
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the write to wait for the evicted Logger")
+	case <-time.After(50 * time.Millisecond):
+	}
+	r.closeEvicted([]*routeEntry{evicted})
+	isNil(<-done, t)
+	existsWithContent(filepath.Join(dir, "a.log"), []byte("a\nb\n"), t)
+
+	// A write racing with the eviction goes to the replacement Logger.
+	n, open, err := evicted.l.writeIfOpen([]byte("c\n"))
+	equals(0, n, t)
+	equals(false, open, t)
+	isNil(err, t)
+}
+
+func TestRouter_ConcurrentEvictions(t *testing.T) {
+	dir := mktempDir(t)
+	r := &Router{
+		Filename: filepath.Join(dir, "{key}.log"),
+		MaxOpen:  1,
+		Base:     &Logger{Manifest: true, MaxSize: 1, BackupSequence: true}, // rotations within a millisecond
+	}
+	megabyte = 1024
+	defer func() { megabyte = 1024 * 1024 }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if _, err := r.WriteKey(key, []byte("0123456789012345678901234567890123456789\n")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(fmt.Sprintf("k%d", i%2))
+	}
+	wg.Wait()
+	isNil(r.Close(), t)
+
+	// No bytes were lost, no file grew past MaxSize, and the manifest matches
+	// the backups.
+	var total int64
+	entries, err := os.ReadDir(dir)
+	isNil(err, t)
+	for _, e := range entries {
+		info, err := e.Info()
+		isNil(err, t)
+		if strings.HasSuffix(e.Name(), ".manifest.jsonl") {
+			continue
+		}
+		assert(info.Size() <= 1024, t, "%s has %d bytes", e.Name(), info.Size())
+		total += info.Size()
+	}
+	equals(int64(4*200*41), total, t)
+	for _, key := range []string{"k0", "k1"} {
+		l := &Logger{Filename: filepath.Join(dir, key+".log"), Manifest: true}
+		failed, err := l.VerifyManifest()
+		isNil(err, t)
+		equals(0, len(failed), t)
+	}
+}
+
+func TestRouter_IdleTTL(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	currentTime = func() time.Time { return now }
+
+	dir := mktempDir(t)
+	// The janitor's interval is long enough not to interfere; evictIdle is called directly.
+	r := &Router{Filename: filepath.Join(dir, "{key}.log"), IdleTTL: time.Hour}
+	defer r.Close()
+
+	_, err := r.WriteKey("a", []byte("a\n"))
+	isNil(err, t)
+	now = start.Add(30 * time.Minute)
+	_, err = r.WriteKey("b", []byte("b\n"))
+	isNil(err, t)
+
+	now = start.Add(70 * time.Minute)
+	r.evictIdle()
+	r.mu.Lock()
+	_, aOpen := r.entries["a"]
+	_, bOpen := r.entries["b"]
+	r.mu.Unlock()
+	assert(!aOpen, t, "expected a to be closed after being idle")
+	assert(bOpen, t, "expected b to stay open")
+}
+
+func TestMaxLines(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	filename := logFile(dir)
+	l := &Logger{Filename: filename, MaxLines: 3}
+	defer l.Close()
+
+	writeOnce(t, l, "a\nb\n")
+	writeOnce(t, l, "c\n")
+	fileCount(dir, 1, t)
+	writeOnce(t, l, "d\n") // would be the 4th line
+	existsWithContent(backupFileWithReason(dir, "lines"), []byte("a\nb\nc\n"), t)
+	existsWithContent(filename, []byte("d\n"), t)
+	isNil(l.Close(), t)
+
+	// A reopened file's lines are counted.
+	newFakeTime()
+	l2 := &Logger{Filename: filename, MaxLines: 2}
+	defer l2.Close()
+	writeOnce(t, l2, "e\n")
+	existsWithContent(filename, []byte("d\ne\n"), t)
+	writeOnce(t, l2, "f\ng\nh\n") // more lines than MaxLines: not split
+	existsWithContent(backupFileWithReason(dir, "lines"), []byte("d\ne\n"), t)
+	existsWithContent(filename, []byte("f\ng\nh\n"), t)
+	fileCount(dir, 3, t)
+	isNil(l2.Close(), t)
+
+	// In a reopened file, the Header's lines count too.
+	newFakeTime()
+	isNil(os.WriteFile(filename, []byte("# header\nx\n"), 0644), t)
+	l3 := &Logger{Filename: filename, MaxLines: 2, Header: func(SegmentInfo) []byte { return []byte("# header\n") }}
+	defer l3.Close()
+	writeOnce(t, l3, "y\n")
+	existsWithContent(backupFileWithReason(dir, "lines"), []byte("# header\nx\n"), t)
+	existsWithContent(filename, []byte("# header\ny\n"), t)
+}
+
+func TestMinRotationInterval(t *testing.T) {
+	oldNow, oldSleep := currentTime, sleep
+	defer func() { currentTime, sleep = oldNow, oldSleep }()
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+
+	for _, policy := range []string{"grow", "block"} {
+		t.Run(policy, func(t *testing.T) {
+			start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+			fakeCurrentTime = start
+			var slept time.Duration
+			sleep = func(d time.Duration, _ <-chan struct{}) {
+				slept += d
+				fakeCurrentTime = fakeCurrentTime.Add(d)
+			}
+
+			dir := mktempDir(t)
+			l := &Logger{Filename: logFile(dir), MaxSize: 10, MinRotationInterval: time.Minute, MinRotationPolicy: policy}
+			defer l.Close()
+			writeOnce(t, l, "12345678")
+			fakeCurrentTime = start.Add(20 * time.Second)
+			writeOnce(t, l, "abcd") // past MaxSize within a minute
+			equals(int64(1), l.SuppressedRotations(), t)
+
+			if policy == "grow" {
+				equals(time.Duration(0), slept, t)
+				existsWithContent(l.Filename, []byte("12345678abcd"), t)
+				fileCount(dir, 1, t)
+
+				fakeCurrentTime = start.Add(2 * time.Minute)
+				writeOnce(t, l, "x")
+				existsWithContent(backupFileWithReason(dir, "size"), []byte("12345678abcd"), t)
+			} else {
+				equals(40*time.Second, slept, t)
+				existsWithContent(backupFileWithReason(dir, "size"), []byte("12345678"), t)
+				existsWithContent(l.Filename, []byte("abcd"), t)
+			}
+			fileCount(dir, 2, t)
+		})
+	}
+}
+
+func TestMinRotationInterval_Restart(t *testing.T) {
+	oldNow, oldSleep := currentTime, sleep
+	defer func() { currentTime, sleep = oldNow, oldSleep }()
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+
+	for _, policy := range []string{"grow", "block"} {
+		t.Run(policy, func(t *testing.T) {
+			start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+			fakeCurrentTime = start
+			var slept time.Duration
+			sleep = func(d time.Duration, _ <-chan struct{}) {
+				slept += d
+				fakeCurrentTime = fakeCurrentTime.Add(d)
+			}
+
+			// The previous run rotated at start, then wrote almost MaxSize.
+			dir := mktempDir(t)
+			l1 := &Logger{Filename: logFile(dir), MaxSize: 10}
+			writeOnce(t, l1, "old")
+			isNil(l1.Rotate(), t)
+			writeOnce(t, l1, "12345678")
+			isNil(l1.Close(), t)
+
+			// Restarted 20s later, the file is 20s old.
+			fakeCurrentTime = start.Add(20 * time.Second)
+			l := &Logger{Filename: logFile(dir), MaxSize: 10, MinRotationInterval: time.Minute, MinRotationPolicy: policy}
+			defer l.Close()
+			writeOnce(t, l, "abcd")
+			equals(int64(1), l.SuppressedRotations(), t)
+
+			if policy == "grow" {
+				equals(time.Duration(0), slept, t)
+				existsWithContent(l.Filename, []byte("12345678abcd"), t)
+				fileCount(dir, 2, t)
+			} else {
+				equals(40*time.Second, slept, t)
+				existsWithContent(backupFileWithReason(dir, "size"), []byte("12345678"), t)
+				existsWithContent(l.Filename, []byte("abcd"), t)
+				fileCount(dir, 3, t)
+			}
+		})
+	}
+}
+
+func TestMinRotationInterval_CountsWrites(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	fakeCurrentTime = start
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), MaxSize: 10, MaxLines: 1, MinRotationInterval: time.Minute}
+	defer l.Close()
+	writeOnce(t, l, "a\n")
+	fakeCurrentTime = start.Add(20 * time.Second)
+	writeOnce(t, l, "12345678\n") // past both MaxSize and MaxLines: one write
+	equals(int64(1), l.SuppressedRotations(), t)
+}
+
+func TestMinRotationInterval_BlockedWriteDoesNotLock(t *testing.T) {
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), MaxSize: 10, MinRotationInterval: time.Hour, MinRotationPolicy: "block"}
+	writeOnce(t, l, "12345678")
+
+	done := make(chan error)
+	go func() {
+		_, err := l.Write([]byte("abcd")) // blocks for an hour
+		done <- err
+	}()
+	for l.SuppressedRotations() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	isNil(l.Sync(), t)
+
+	closed := make(chan error)
+	go func() { closed <- l.Close() }()
+	select {
+	case err := <-closed:
+		isNil(err, t)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the blocked write")
+	}
+	isNil(<-done, t) // ended by Close, written like any write after Close
+	existsWithContent(l.Filename, []byte("12345678abcd"), t)
+}
+
+func TestSkipEmptyRotation(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	l := &Logger{
+		Filename:          logFile(dir),
+		SkipEmptyRotation: true,
+		RotationInterval:  time.Hour,
+		Header:            func(SegmentInfo) []byte { return []byte("# header\n") },
+	}
+	defer l.Close()
+
+	isNil(l.Rotate(), t) // nothing written yet
+	fileCount(dir, 0, t)
+
+	writeOnce(t, l, "a\n")
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	existsWithContent(backupFileWithReason(dir, "time"), []byte("# header\na\n"), t) // the interval is due
+	fileCount(dir, 2, t)
+
+	// The new file only has its header: manual and interval rotations are skipped.
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	writeOnce(t, l, "b\n") // the interval has passed
+	fileCount(dir, 2, t)
+	existsWithContent(l.Filename, []byte("# header\nb\n"), t)
+	equals(fakeTime().In(l.location()), l.lastRotationTime, t)
+	isNil(l.Close(), t)
+
+	// A reopened file can't tell its header from data: it isn't empty.
+	isNil(os.WriteFile(l.Filename, []byte("# header\n"), 0644), t)
+	l2 := &Logger{Filename: l.Filename, SkipEmptyRotation: true}
+	defer l2.Close()
+	writeOnce(t, l2, "")
+	newFakeTime()
+	isNil(l2.RotateWithReason("manual"), t)
+	existsWithContent(backupFileWithReason(dir, "manual"), []byte("# header\n"), t)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	fakeCurrentTime = start
+
+	dir := mktempDir(t)
+	l := &Logger{Filename: logFile(dir), IdleTimeout: time.Hour}
+	defer l.Close()
+	writeOnce(t, l, "a\n")
+
+	// The timer fires early (as seen by the clock): it's re-armed.
+	fakeCurrentTime = start.Add(30 * time.Minute)
+	l.rotateIfIdle()
+	fileCount(dir, 1, t)
+	assert(l.idleArmed, t, "expected the idle timer to be re-armed")
+
+	fakeCurrentTime = start.Add(61 * time.Minute)
+	l.rotateIfIdle()
+	existsWithContent(backupFileWithReason(dir, "idle"), []byte("a\n"), t)
+	fileCount(dir, 2, t)
+
+	// Nothing was written since: no empty backup.
+	fakeCurrentTime = start.Add(3 * time.Hour)
+	l.rotateIfIdle()
+	fileCount(dir, 2, t)
+	assert(!l.idleArmed, t, "expected the idle timer to wait for the next write")
+}
+
+func TestReopen(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+
+	dir := mktempDir(t)
+	l := &Logger{
+		Filename:         logFile(dir),
+		MaxSize:          20,
+		RotationInterval: time.Hour,
+		Header:           func(SegmentInfo) []byte { return []byte("# header\n") },
+	}
+	defer l.Close()
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	isNil(l.Reopen(), t) // creates the file
+	existsWithContent(l.Filename, []byte("# header\n"), t)
+	lastRotation := l.lastRotationTime
+	equals(fakeTime().In(l.location()), lastRotation, t)
+
+	// The file was moved aside by someone else: a new one is created, no backup is made.
+	writeOnce(t, l, "a\n")
+	moved := filepath.Join(dir, "moved.log")
+	isNil(os.Rename(l.Filename, moved), t)
+	isNil(l.Reopen(), t)
+	existsWithContent(l.Filename, []byte("# header\n"), t)
+	existsWithContent(moved, []byte("# header\na\n"), t)
+	fileCount(dir, 2, t)
+	equals(lastRotation, l.lastRotationTime, t)
+
+	// The file was replaced: its size counts towards MaxSize.
+	replaced := []byte("0123456789abcdef\n")
+	isNil(os.WriteFile(l.Filename, replaced, 0644), t)
+	isNil(l.Reopen(), t)
+	equals(int64(len(replaced)), l.size, t)
+	writeOnce(t, l, "b\n")
+	fileCount(dir, 2, t)
+	writeOnce(t, l, "c\n")
+	existsWithContent(backupFileWithReason(dir, "size"), append(replaced, "b\n"...), t)
+
+	isNil(l.Close(), t)
+	notNil(l.Reopen(), t)
+}
+
+func TestBackups(t *testing.T) {
+	dir := mktempDir(t)
+	l := &Logger{
+		Filename:          logFile(dir),
+		MaxBackups:        2,
+		Compression:       "gzip",
+		DeleteZeroSizeLog: true,
+		BackupSequence:    true,
+	}
+	defer l.Close()
+
+	start := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	name := func(i int, rest string) string {
+		return filepath.Join(dir, "foobar-"+start.Add(time.Duration(i)*time.Hour).Format(backupTimeFormat)+rest)
+	}
+	gz := string(gzipped("gz", t))
+	files := map[string]string{
+		name(3, "-size-1.log"):          "",    // empty: removed by DeleteZeroSizeLog
+		name(2, "-lines-2.log"):         "abc", // waits for compression
+		name(1, "-time-1.log.gz"):       gz,
+		name(0, "-sighup-1.log"):        "old", // beyond MaxBackups
+		filepath.Join(dir, "notes.txt"): "not a backup",
+	}
+	for n, content := range files {
+		isNil(os.WriteFile(n, []byte(content), 0644), t)
+	}
+
+	backups, err := l.Backups()
+	isNil(err, t)
+	equals([]BackupInfo{
+		{Path: name(3, "-size-1.log"), Time: start.Add(3 * time.Hour), Reason: "size", Sequence: 1, Compression: "none", PendingDeletion: true},
+		{Path: name(2, "-lines-2.log"), Time: start.Add(2 * time.Hour), Reason: "lines", Sequence: 2, Compression: "none", Size: 3, PendingCompression: true},
+		{Path: name(1, "-time-1.log.gz"), Time: start.Add(time.Hour), Reason: "time", Sequence: 1, Compression: "gzip", Size: int64(len(gz))},
+		{Path: name(0, "-sighup-1.log"), Time: start, Reason: "sighup", Sequence: 1, Compression: "none", Size: 3, PendingDeletion: true},
+	}, backups, t)
+
+	// The mill does what Backups announced.
+	isNil(l.millRunOnce(), t)
+	backups, err = l.Backups()
+	isNil(err, t)
+	equals(2, len(backups), t)
+	equals(name(2, "-lines-2.log.gz"), backups[0].Path, t)
+	equals("gzip", backups[0].Compression, t)
+	equals(false, backups[0].PendingCompression, t)
+	equals(name(1, "-time-1.log.gz"), backups[1].Path, t)
+}
+
+func TestPlanRetention(t *testing.T) {
+	oldNow := currentTime
+	defer func() { currentTime = oldNow }()
+	currentTime = fakeTime
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)
+	fakeCurrentTime = now
+
+	dir := mktempDir(t)
+	l := &Logger{
+		Filename:          logFile(dir),
+		MaxBackups:        3,
+		MaxAge:            1,
+		Compression:       "gzip",
+		DeleteZeroSizeLog: true,
+	}
+	defer l.Close()
+
+	name := func(ago time.Duration, rest string) string {
+		return filepath.Join(dir, "foobar-"+now.Add(-ago).Format(backupTimeFormat)+rest)
+	}
+	files := map[string]string{
+		name(time.Hour, "-size.log"):         "", // empty
+		name(90*time.Minute, "-time.log.gz"): string(gzipped("gz", t)),
+		name(2*time.Hour, "-size.log"):       "a",
+		name(48*time.Hour, "-size.log"):      "b", // older than MaxAge
+		name(72*time.Hour, "-size.log"):      "c", // beyond MaxBackups
+	}
+	for n, content := range files {
+		isNil(os.WriteFile(n, []byte(content), 0644), t)
+	}
+
+	plan, err := l.PlanRetention()
+	isNil(err, t)
+	equals(RetentionPlan{
+		Keep: []string{name(90*time.Minute, "-time.log.gz")},
+		Delete: []RetentionDelete{
+			{Path: name(time.Hour, "-size.log"), Rule: RuleDeleteZeroSizeLog},
+			{Path: name(48*time.Hour, "-size.log"), Rule: RuleMaxAge},
+			{Path: name(72*time.Hour, "-size.log"), Rule: RuleMaxBackups},
+		},
+		Compress: []string{name(2*time.Hour, "-size.log")},
+	}, plan, t)
+	fileCount(dir, 5, t) // nothing was done
+
+	// The mill runs the same plan.
+	isNil(l.millRunOnce(), t)
+	fileCount(dir, 2, t)
+	plan, err = l.PlanRetention()
+	isNil(err, t)
+	equals(RetentionPlan{
+		Keep: []string{name(90*time.Minute, "-time.log.gz"), name(2*time.Hour, "-size.log.gz")},
+	}, plan, t)
+}
+
+func TestPlanRetention_InterruptedCompression(t *testing.T) {
+	dir := t.TempDir()
+	l := &Logger{Filename: logFile(dir), Compression: "gzip"}
+	defer l.Close()
+
+	name := func(minute int) string {
+		return filepath.Join(dir, fmt.Sprintf("foobar-2025-05-01T10-%02d-00.000-size.log", minute))
+	}
+	// A crash while writing the temp file, and one after the archive was
+	// complete but before its source was removed.
+	temp := compressTempName(name(1) + compressSuffix)
+	isNil(os.WriteFile(temp, []byte("partial"), 0644), t)
+	isNil(os.WriteFile(name(1), []byte("one"), 0644), t)
+	isNil(os.WriteFile(name(2), []byte("two"), 0644), t)
+	isNil(compressLogFile(name(2), name(2)+compressSuffix), t)
+	isNil(os.WriteFile(name(2), []byte("two"), 0644), t)
+
+	// The plan doesn't model the recovery of the first mill pass: the temp
+	// file isn't listed and both copies of the second backup are.
+	plan, err := l.PlanRetention()
+	isNil(err, t)
+	equals(RetentionPlan{
+		Keep:     []string{name(2) + compressSuffix},
+		Compress: []string{name(2), name(1)},
+	}, plan, t)
+
+	isNil(l.millRunOnce(), t)
+	notExist(temp, t)
+	notExist(name(2), t)
+	plan, err = l.PlanRetention()
+	isNil(err, t)
+	equals(RetentionPlan{
+		Keep: []string{name(2) + compressSuffix, name(1) + compressSuffix},
+	}, plan, t)
+}